@@ -2,6 +2,7 @@ package helpers
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
@@ -120,8 +121,8 @@ func LoadEnv(envNames []string) (*map[string]string, error) {
 	return &envMap, nil
 }
 
-func GetWithHeaders(client *http.Client, url string, headers http.Header) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+func GetWithHeaders(ctx context.Context, client *http.Client, url string, headers http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed creating new request: %w", err)
 	}
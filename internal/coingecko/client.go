@@ -1,6 +1,7 @@
 package coingecko
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,11 +9,13 @@ import (
 	"kasegu/external/helpers"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const envName = "COINGECKO_API_KEY"
 const headerName = "x-cg-demo-api-key"
 const coingeckoURL = "https://api.coingecko.com/api/v3"
+const clientTimeout = 30 * time.Second
 
 const pingEndpoint = "/ping"
 
@@ -34,9 +37,9 @@ type CoinData struct {
 	Platform map[string]interface{} `json:"platform"`
 }
 
-func (c *Coingecko) Ping() (string, error) {
+func (c *Coingecko) Ping(ctx context.Context) (string, error) {
 	url := fmt.Sprintf("%s%s", coingeckoURL, pingEndpoint)
-	resp, err := helpers.GetWithHeaders(c.client, url, http.Header{headerName: {c.apiKey}})
+	resp, err := helpers.GetWithHeaders(ctx, c.client, url, http.Header{headerName: {c.apiKey}})
 	if err != nil {
 		return "", fmt.Errorf("failed pinging coingecko API: %w", err)
 	}
@@ -48,7 +51,7 @@ func (c *Coingecko) Ping() (string, error) {
 	return string(body), nil
 }
 
-func (c *Coingecko) CoinsList() (*[]CoinData, error) {
+func (c *Coingecko) CoinsList(ctx context.Context) (*[]CoinData, error) {
 	ok := helpers.IsThereSerializedData(coinsListSerializedDataFilename)
 	if ok {
 		fmt.Println("Attempting to Fetch Coins Data from Local Disk...")
@@ -60,7 +63,7 @@ func (c *Coingecko) CoinsList() (*[]CoinData, error) {
 	}
 	fmt.Println("Attempting to connect to CG API to Fetch Coins...")
 	url := fmt.Sprintf("%s%s", coingeckoURL, coinsListEndpoint)
-	resp, err := helpers.GetWithHeaders(c.client, url, http.Header{headerName: {c.apiKey}})
+	resp, err := helpers.GetWithHeaders(ctx, c.client, url, http.Header{headerName: {c.apiKey}})
 	if err != nil {
 		return nil, fmt.Errorf("failed connecting to coingecko API: %w", err)
 	}
@@ -118,7 +121,7 @@ type GetCoinHistoricalChartParams struct {
 	Coin       *CoinData
 }
 
-func (c *Coingecko) CoinHistoricalChart(params *GetCoinHistoricalChartParams) (string, error) {
+func (c *Coingecko) CoinHistoricalChart(ctx context.Context, params *GetCoinHistoricalChartParams) (string, error) {
 	if params.Coin == nil || params.From == 0 || params.To == 0 {
 		return "", errors.New("required parameters not provided")
 	}
@@ -144,7 +147,7 @@ func (c *Coingecko) CoinHistoricalChart(params *GetCoinHistoricalChartParams) (s
 	}
 	url = helpers.AppendQueryParameters(url, &qParamMap)
 	fmt.Println(url)
-	resp, err := helpers.GetWithHeaders(c.client, url, http.Header{headerName: {c.apiKey}})
+	resp, err := helpers.GetWithHeaders(ctx, c.client, url, http.Header{headerName: {c.apiKey}})
 	if err != nil {
 		return "", fmt.Errorf("failed connecting to congecko API: %w", err)
 	}
@@ -157,7 +160,7 @@ func (c *Coingecko) CoinHistoricalChart(params *GetCoinHistoricalChartParams) (s
 }
 
 func CreateClient() (*Coingecko, error) {
-	client := &http.Client{}
+	client := &http.Client{Timeout: clientTimeout}
 	envMap, err := helpers.LoadEnv([]string{envName})
 	if err != nil {
 		return nil, fmt.Errorf("failed retriving api key for coin gecko: %w", err)
@@ -10,6 +10,10 @@ const (
 	coingeckoName     = "COINGECKO_API_KEY"
 	krakenApiName     = "KRAKEN_API_KEY"
 	krakenPrivateName = "KRAKEN_PRIVATE_KEY"
+
+	defaultDeadManSwitchInterval = 20
+	defaultDeadManSwitchTimeout  = 60
+	defaultKrakenTier            = "starter"
 )
 
 var (
@@ -23,12 +27,28 @@ type Data struct {
 	EnableBot        bool
 	BaseCurrency     string
 	TradingCoin      string
+	// DeadManSwitchInterval and DeadManSwitchTimeout are in seconds. A timeout
+	// of 0 with an interval set disables the dead man's switch, while both
+	// being 0 means the data predates it and the defaults are used.
+	DeadManSwitchInterval uint32
+	DeadManSwitchTimeout  uint32
+	// KrakenTier is the account verification level used for rate limiting:
+	// starter, intermediate or pro.
+	KrakenTier string
+	// DryRun has the bot validate its orders with Kraken without placing them.
+	DryRun bool
+	// Strategy names the registered strategy the bot trades with, or is empty
+	// for the default one, configured by StrategyParams. Unset parameters take
+	// the strategy's defaults.
+	Strategy       string
+	StrategyParams map[string]float64
 }
 
 func LoadData() (*Data, error) {
 	data, err := helpers.UnserializeData[Data](fileName)
 	if err == nil {
 		fmt.Println("Data loaded from file successfully")
+		applyDefaults(data)
 		return data, nil
 	}
 	envMap, err := helpers.LoadEnv(envNames)
@@ -36,15 +56,30 @@ func LoadData() (*Data, error) {
 		return nil, fmt.Errorf("error loading env variables: %v", err)
 	}
 	return &Data{
-		CoinGeckoApiKey:  (*envMap)[coingeckoName],
-		KrakenApiKey:     (*envMap)[krakenApiName],
-		KrakenPrivateKey: (*envMap)[krakenPrivateName],
-		EnableBot:        true,
-		BaseCurrency:     "USD",
-		TradingCoin:      "PENGU",
+		CoinGeckoApiKey:       (*envMap)[coingeckoName],
+		KrakenApiKey:          (*envMap)[krakenApiName],
+		KrakenPrivateKey:      (*envMap)[krakenPrivateName],
+		EnableBot:             true,
+		BaseCurrency:          "USD",
+		TradingCoin:           "PENGU",
+		DeadManSwitchInterval: defaultDeadManSwitchInterval,
+		DeadManSwitchTimeout:  defaultDeadManSwitchTimeout,
+		KrakenTier:            defaultKrakenTier,
 	}, nil
 }
 
+// applyDefaults fills in the fields added since data was saved, which decode
+// as their zero values.
+func applyDefaults(data *Data) {
+	if data.DeadManSwitchInterval == 0 && data.DeadManSwitchTimeout == 0 {
+		data.DeadManSwitchInterval = defaultDeadManSwitchInterval
+		data.DeadManSwitchTimeout = defaultDeadManSwitchTimeout
+	}
+	if data.KrakenTier == "" {
+		data.KrakenTier = defaultKrakenTier
+	}
+}
+
 func SaveData(data *Data) error {
 	err := helpers.SerializeData[Data](data, fileName)
 	return err
@@ -1,24 +1,31 @@
 package ibkr
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"kasegu/external/helpers"
 	"net/http"
+	"time"
 )
 
 const ibkrUrl = "https://localhost:5000/v1/api"
 const authStatusEndpoint = "/iserver/auth/status"
+const clientTimeout = 30 * time.Second
 
 type Ibkr struct {
 	client *http.Client
 }
 
-func (i *Ibkr) IsAuthenticated() (bool, error) {
+func (i *Ibkr) IsAuthenticated(ctx context.Context) (bool, error) {
 	url := fmt.Sprintf("%s%s", ibkrUrl, authStatusEndpoint)
-	resp, err := i.client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed creating new request: %w", err)
+	}
+	resp, err := i.client.Do(req)
 	if err != nil {
 		return false, fmt.Errorf("failed connecting to endpoint: %w", err)
 	}
@@ -40,6 +47,6 @@ func (i *Ibkr) IsAuthenticated() (bool, error) {
 
 func CreateClient() *Ibkr {
 	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	client := &http.Client{Transport: tr}
+	client := &http.Client{Transport: tr, Timeout: clientTimeout}
 	return &Ibkr{client: client}
 }
@@ -0,0 +1,317 @@
+package kraken
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultBookDepth is the depth Kraken uses when a book subscription doesn't
+// ask for one.
+const defaultBookDepth = 10
+
+// checksumDepth is how many levels per side Kraken's checksum covers.
+const checksumDepth = 10
+
+// LocalBook is an L2 order book kept in sync with the book channel. Bids are
+// sorted from best to worst, as are asks. Levels keep Kraken's decimals as
+// sent, so prices are never rounded.
+type LocalBook struct {
+	symbol         string
+	depth          int
+	pricePrecision int
+	qtyPrecision   int
+	bids           []BookLevel
+	asks           []BookLevel
+	// synced is false until a snapshot arrives and again after a checksum
+	// mismatch, until the book has been resynced.
+	synced    bool
+	timestamp string
+	sync.RWMutex
+}
+
+func newLocalBook(symbol string, depth int, pricePrecision int, qtyPrecision int) *LocalBook {
+	if depth <= 0 {
+		depth = defaultBookDepth
+	}
+	return &LocalBook{
+		symbol:         symbol,
+		depth:          depth,
+		pricePrecision: pricePrecision,
+		qtyPrecision:   qtyPrecision,
+	}
+}
+
+func (b *LocalBook) Symbol() string {
+	return b.symbol
+}
+
+// Depth returns how many levels per side the book keeps.
+func (b *LocalBook) Depth() int {
+	return b.depth
+}
+
+// Synced reports whether the book currently matches Kraken's.
+func (b *LocalBook) Synced() bool {
+	b.RLock()
+	defer b.RUnlock()
+	return b.synced
+}
+
+// Timestamp returns the time of the last snapshot or update applied.
+func (b *LocalBook) Timestamp() string {
+	b.RLock()
+	defer b.RUnlock()
+	return b.timestamp
+}
+
+func (b *LocalBook) BestBid() (BookLevel, bool) {
+	b.RLock()
+	defer b.RUnlock()
+	if len(b.bids) == 0 {
+		return BookLevel{}, false
+	}
+	return b.bids[0], true
+}
+
+func (b *LocalBook) BestAsk() (BookLevel, bool) {
+	b.RLock()
+	defer b.RUnlock()
+	if len(b.asks) == 0 {
+		return BookLevel{}, false
+	}
+	return b.asks[0], true
+}
+
+// Levels returns a copy of up to n of the best levels on side, or all of them
+// when n is 0.
+func (b *LocalBook) Levels(side string, n int) []BookLevel {
+	b.RLock()
+	defer b.RUnlock()
+	levels := b.side(side)
+	if n <= 0 || n > len(levels) {
+		n = len(levels)
+	}
+	out := make([]BookLevel, n)
+	copy(out, levels[:n])
+	return out
+}
+
+// VolumeAt returns the quantity resting at exactly price on side, or "0" if
+// there is none.
+func (b *LocalBook) VolumeAt(side string, price float64) Decimal {
+	b.RLock()
+	defer b.RUnlock()
+	levels := b.side(side)
+	i, found := b.search(side, levels, price)
+	if !found {
+		return "0"
+	}
+	return levels[i].Volume
+}
+
+// CumulativeVolume returns the quantity resting on side at price or better,
+// i.e. what a taker on the other side could fill up to price.
+func (b *LocalBook) CumulativeVolume(side string, price float64) float64 {
+	b.RLock()
+	defer b.RUnlock()
+	var total float64
+	for _, l := range b.side(side) {
+		if better(side, price, levelPrice(l)) {
+			break
+		}
+		v, _ := l.Volume.Float64()
+		total += v
+	}
+	return total
+}
+
+// Snapshot returns the whole book as the book channel would send it, with the
+// checksum of its current levels.
+func (b *LocalBook) Snapshot() BookUpdate {
+	b.RLock()
+	defer b.RUnlock()
+	return BookUpdate{
+		Symbol:    b.symbol,
+		Bids:      append([]BookLevel(nil), b.bids...),
+		Asks:      append([]BookLevel(nil), b.asks...),
+		Checksum:  b.checksum(),
+		Timestamp: b.timestamp,
+	}
+}
+
+func (b *LocalBook) side(side string) []BookLevel {
+	if side == SideSell {
+		return b.asks
+	}
+	return b.bids
+}
+
+// better reports whether price a is strictly better than b on side.
+func better(side string, a float64, b float64) bool {
+	if side == SideSell {
+		return a < b
+	}
+	return a > b
+}
+
+// levelPrice is used to order levels. Distinct decimals of the precision
+// Kraken uses parse to distinct floats, so ordering by them is exact.
+func levelPrice(l BookLevel) float64 {
+	p, _ := l.Price.Float64()
+	return p
+}
+
+func (b *LocalBook) search(side string, levels []BookLevel, price float64) (int, bool) {
+	i := sort.Search(len(levels), func(i int) bool {
+		return !better(side, levelPrice(levels[i]), price)
+	})
+	return i, i < len(levels) && levelPrice(levels[i]) == price
+}
+
+// apply updates side with the given levels, removing those with a quantity of
+// zero, and truncates it to the subscribed depth.
+func (b *LocalBook) apply(side string, levels []BookLevel) ([]BookLevel, error) {
+	book := b.side(side)
+	for _, l := range levels {
+		price, err := l.Price.Float64()
+		if err != nil {
+			return book, fmt.Errorf("invalid book price %s: %w", l.Price, err)
+		}
+		qty, err := l.Volume.Float64()
+		if err != nil {
+			return book, fmt.Errorf("invalid book quantity %s: %w", l.Volume, err)
+		}
+		i, found := b.search(side, book, price)
+		switch {
+		case found && qty == 0:
+			book = append(book[:i], book[i+1:]...)
+		case found:
+			book[i] = l
+		case qty != 0:
+			book = append(book, BookLevel{})
+			copy(book[i+1:], book[i:])
+			book[i] = l
+		}
+	}
+	if len(book) > b.depth {
+		book = book[:b.depth]
+	}
+	return book, nil
+}
+
+// update applies a snapshot or update message and reports whether the book
+// still matches Kraken's checksum. Updates are ignored until a snapshot has
+// been applied.
+func (b *LocalBook) update(snapshot bool, data *BookUpdate) bool {
+	b.Lock()
+	defer b.Unlock()
+	if snapshot {
+		b.bids, b.asks = nil, nil
+		b.synced = true
+	} else if !b.synced {
+		return true
+	}
+	var bidErr, askErr error
+	b.bids, bidErr = b.apply(SideBuy, data.Bids)
+	b.asks, askErr = b.apply(SideSell, data.Asks)
+	b.timestamp = data.Timestamp
+	if bidErr != nil || askErr != nil || b.checksum() != data.Checksum {
+		b.synced = false
+		return false
+	}
+	return true
+}
+
+// checksum is Kraken's CRC32 of the top ten asks followed by the top ten bids,
+// each level written as price then quantity at the pair's precision with the
+// decimal point and leading zeros removed.
+func (b *LocalBook) checksum() uint32 {
+	var sb strings.Builder
+	for _, levels := range [][]BookLevel{b.asks, b.bids} {
+		for i, l := range levels {
+			if i == checksumDepth {
+				break
+			}
+			sb.WriteString(checksumField(l.Price, b.pricePrecision))
+			sb.WriteString(checksumField(l.Volume, b.qtyPrecision))
+		}
+	}
+	return crc32.ChecksumIEEE([]byte(sb.String()))
+}
+
+func checksumField(d Decimal, precision int) string {
+	s := d.fixed(precision)
+	return strings.TrimLeft(strings.Replace(s, ".", "", 1), "0")
+}
+
+// fixed writes d with exactly decimals digits after the point, padding or
+// truncating its text rather than going through a float.
+func (d Decimal) fixed(decimals int) string {
+	s := string(d)
+	if strings.ContainsAny(s, "eE") {
+		f, _ := d.Float64()
+		return strconv.FormatFloat(f, 'f', decimals, 64)
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > decimals {
+		frac = frac[:decimals]
+	}
+	frac += strings.Repeat("0", decimals-len(frac))
+	if decimals == 0 {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+// bookEngine holds the local books of a websocket client by symbol.
+type bookEngine struct {
+	books map[string]*LocalBook
+	sync.Mutex
+}
+
+func newBookEngine() *bookEngine {
+	return &bookEngine{books: make(map[string]*LocalBook)}
+}
+
+func (be *bookEngine) track(book *LocalBook) {
+	be.Lock()
+	defer be.Unlock()
+	be.books[book.symbol] = book
+}
+
+func (be *bookEngine) untrack(symbol string) {
+	be.Lock()
+	defer be.Unlock()
+	delete(be.books, symbol)
+}
+
+func (be *bookEngine) get(symbol string) (*LocalBook, bool) {
+	be.Lock()
+	defer be.Unlock()
+	b, ok := be.books[symbol]
+	return b, ok
+}
+
+// handle applies a book channel event and returns the symbols whose books no
+// longer match Kraken's and need resyncing.
+func (be *bookEngine) handle(e *Event) ([]string, error) {
+	data, err := e.BookUpdates()
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for i := range data {
+		book, ok := be.get(data[i].Symbol)
+		if !ok {
+			continue
+		}
+		if !book.update(e.Type == "snapshot", &data[i]) {
+			stale = append(stale, book.symbol)
+		}
+	}
+	return stale, nil
+}
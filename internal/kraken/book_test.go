@@ -0,0 +1,78 @@
+package kraken
+
+import (
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestLocalBook(t *testing.T) {
+	be := newBookEngine()
+	book := newLocalBook("BTC/USD", 10, 1, 3)
+	be.track(book)
+	snapshot := &Event{
+		Channel: "book",
+		Type:    "snapshot",
+		Data: []byte(`[{"symbol":"BTC/USD","bids":[{"price":100.5,"qty":1.5},{"price":100.0,"qty":2}],` +
+			`"asks":[{"price":101.0,"qty":0.5},{"price":102.5,"qty":3}],"checksum":` +
+			checksumOf("1010500102530001005150010002000") + `}]`),
+	}
+	if stale, err := be.handle(snapshot); err != nil || len(stale) != 0 {
+		t.Fatalf("snapshot rejected: %v %v", stale, err)
+	}
+	update := &Event{
+		Channel: "book",
+		Type:    "update",
+		Data: []byte(`[{"symbol":"BTC/USD","bids":[{"price":100.0,"qty":0},{"price":100.7,"qty":1}],` +
+			`"asks":[{"price":101.0,"qty":0.25}],"checksum":` + checksumOf("1010250102530001007100010051500") + `}]`),
+	}
+	if stale, err := be.handle(update); err != nil || len(stale) != 0 {
+		t.Fatalf("update rejected: %v %v", stale, err)
+	}
+	if bid, _ := book.BestBid(); bid.Price != "100.7" {
+		t.Errorf("incorrect best bid: %v", bid)
+	}
+	if ask, _ := book.BestAsk(); ask.Price != "101.0" || ask.Volume != "0.25" {
+		t.Errorf("incorrect best ask: %v", ask)
+	}
+	if v := book.VolumeAt(SideBuy, 100.0); v != "0" {
+		t.Errorf("removed level still has volume %v", v)
+	}
+	if v := book.CumulativeVolume(SideBuy, 100.5); v != 2.5 {
+		t.Errorf("incorrect cumulative bid volume: %v", v)
+	}
+	if v := book.CumulativeVolume(SideSell, 102.5); v != 3.25 {
+		t.Errorf("incorrect cumulative ask volume: %v", v)
+	}
+	mismatch := &Event{
+		Channel: "book",
+		Type:    "update",
+		Data:    []byte(`[{"symbol":"BTC/USD","bids":[{"price":100.6,"qty":1}],"asks":[],"checksum":1}]`),
+	}
+	if stale, _ := be.handle(mismatch); len(stale) != 1 || book.Synced() {
+		t.Errorf("checksum mismatch not detected: %v", stale)
+	}
+}
+
+func TestDecimalFixed(t *testing.T) {
+	tests := []struct {
+		d        Decimal
+		decimals int
+		want     string
+	}{
+		{"0.5", 3, "0.500"},
+		{"100.12345", 2, "100.12"},
+		{"42", 1, "42.0"},
+		{"1e-05", 6, "0.000010"},
+		{"7.9", 0, "7"},
+	}
+	for _, tt := range tests {
+		if got := tt.d.fixed(tt.decimals); got != tt.want {
+			t.Errorf("%s at %d decimals: expected %s, got %s", tt.d, tt.decimals, tt.want, got)
+		}
+	}
+}
+
+func checksumOf(s string) string {
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(s))), 10)
+}
@@ -0,0 +1,265 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"kasegu/external/helpers"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OHLCIntervals are the candle intervals, in minutes, Kraken serves itself.
+var OHLCIntervals = []uint16{1, 5, 15, 30, 60, 240, 1440, 10080, 21600}
+
+// backfillCandles is how many candles are backfilled when no start is given.
+const backfillCandles = 120
+
+// tradesPageSize is the most trades Kraken returns per Trades request.
+const tradesPageSize = 1000
+
+func IsOHLCInterval(minutes uint16) bool {
+	return slices.Contains(OHLCIntervals, minutes)
+}
+
+// CandleBuilder aggregates trades, or candles of a smaller interval, into
+// candles of any interval aligned to the unix epoch like Kraken's.
+type CandleBuilder struct {
+	interval time.Duration
+	limit    int
+	candles  []OHCLData
+	// lastTradeID lets backfilled and live trades overlap without being
+	// counted twice.
+	lastTradeID int64
+	// lastTradeTime is the unix time of the newest trade added, where
+	// backfilling resumes after a gap in live trades.
+	lastTradeTime int64
+	sync.Mutex
+}
+
+// NewCandleBuilder keeps at most limit candles, or all of them when limit is
+// 0. The interval must be a whole number of seconds.
+func NewCandleBuilder(interval time.Duration, limit int) (*CandleBuilder, error) {
+	if interval < time.Second || interval%time.Second != 0 {
+		return nil, fmt.Errorf("candle interval %s is not a whole number of seconds", interval)
+	}
+	return &CandleBuilder{interval: interval, limit: limit}, nil
+}
+
+func (b *CandleBuilder) Interval() time.Duration {
+	return b.interval
+}
+
+// Candles returns a copy of the candles built so far, oldest first.
+func (b *CandleBuilder) Candles() []OHCLData {
+	b.Lock()
+	defer b.Unlock()
+	return slices.Clone(b.candles)
+}
+
+// start returns the start of the candle containing the unix time t.
+func (b *CandleBuilder) start(t int64) int64 {
+	seconds := int64(b.interval / time.Second)
+	return t - t%seconds
+}
+
+// AddTrade folds a trade into its candle and returns the updated candle. It
+// reports false for trades already seen, judged by a non-zero tradeID.
+func (b *CandleBuilder) AddTrade(price float64, volume float64, t time.Time, tradeID int64) (OHCLData, bool) {
+	b.Lock()
+	defer b.Unlock()
+	if tradeID != 0 {
+		if tradeID <= b.lastTradeID {
+			return OHCLData{}, false
+		}
+		b.lastTradeID = tradeID
+	}
+	b.lastTradeTime = max(b.lastTradeTime, t.Unix())
+	c, isNew := b.candle(b.start(t.Unix()))
+	if isNew {
+		c.Open, c.High, c.Low = price, price, price
+	}
+	c.High = max(c.High, price)
+	c.Low = min(c.Low, price)
+	c.Close = price
+	if total := c.Volume + volume; total > 0 {
+		c.Vwap = (c.Vwap*c.Volume + price*volume) / total
+	}
+	c.Volume += volume
+	c.Trades++
+	return *c, true
+}
+
+// AddCandles resamples candles of a smaller interval, which must divide the
+// builder's, into its candles. Candles must be given oldest first.
+func (b *CandleBuilder) AddCandles(candles []OHCLData, interval time.Duration) error {
+	if interval <= 0 || b.interval%interval != 0 {
+		return fmt.Errorf("can't build %s candles from %s candles", b.interval, interval)
+	}
+	b.Lock()
+	defer b.Unlock()
+	for _, in := range candles {
+		c, isNew := b.candle(b.start(int64(in.Time)))
+		if isNew {
+			c.Open, c.High, c.Low, c.Vwap = in.Open, in.High, in.Low, in.Vwap
+		}
+		c.High = max(c.High, in.High)
+		c.Low = min(c.Low, in.Low)
+		c.Close = in.Close
+		if total := c.Volume + in.Volume; total > 0 {
+			c.Vwap = (c.Vwap*c.Volume + in.Vwap*in.Volume) / total
+		}
+		c.Volume += in.Volume
+		c.Trades += in.Trades
+	}
+	return nil
+}
+
+// candle returns the candle starting at start, inserting an empty one if
+// there is none. Must be called with the lock held.
+func (b *CandleBuilder) candle(start int64) (*OHCLData, bool) {
+	t := float64(start)
+	i := len(b.candles) - 1
+	for i >= 0 && b.candles[i].Time > t {
+		i--
+	}
+	if i >= 0 && b.candles[i].Time == t {
+		return &b.candles[i], false
+	}
+	full := b.limit > 0 && len(b.candles) >= b.limit
+	if full && i < 0 {
+		// Older than every candle kept, so it is built and thrown away.
+		return &OHCLData{Time: t}, true
+	}
+	b.candles = slices.Insert(b.candles, i+1, OHCLData{Time: t})
+	if full {
+		b.candles = b.candles[1:]
+		i--
+	}
+	return &b.candles[i+1], true
+}
+
+// BackfillCandles fills b with candles for pair since the unix time since,
+// or the last backfillCandles of them, resampled from the largest Kraken
+// interval dividing b's. The current candle is resampled from Kraken's still
+// open candles, so no trades are paged for it.
+func BackfillCandles(ctx context.Context, k Kraken, b *CandleBuilder, pair string, since int64) (string, error) {
+	now := clockOf(k)().Unix()
+	from := b.start(now) - backfillCandles*int64(b.interval/time.Second)
+	if since > 0 {
+		from = b.start(since)
+	}
+	key, _, err := resampleCandles(ctx, k, b, pair, from, math.MaxInt64)
+	return key, err
+}
+
+// resampleCandles adds the candles starting from the unix time from and
+// before until, resampled from the largest Kraken interval dividing b's. It
+// returns the pair's key and where the candles added begin, which is later
+// than from if Kraken no longer has its start.
+func resampleCandles(ctx context.Context, k Kraken, b *CandleBuilder, pair string, from int64, until int64) (string, int64, error) {
+	base := baseInterval(b.interval)
+	if base == 0 {
+		return "", from, fmt.Errorf("no Kraken interval divides %s", b.interval)
+	}
+	// since is exclusive, so step back a second to get the candle starting
+	// at from.
+	ohlc, err := k.GetOHCLData(ctx, pair, base, max(from-1, 0))
+	if err != nil {
+		return "", from, err
+	}
+	if len(ohlc.Data) > 0 && int64(ohlc.Data[0].Time) > from {
+		// Kraken returns at most 720 candles whatever since asks for, so the
+		// first candle built from them may be missing its start.
+		from = b.start(int64(ohlc.Data[0].Time)-1) + int64(b.interval/time.Second)
+	}
+	candles := slices.DeleteFunc(ohlc.Data, func(c OHCLData) bool {
+		return int64(c.Time) < from || int64(c.Time) >= until
+	})
+	if err := b.AddCandles(candles, time.Duration(base)*time.Minute); err != nil {
+		return "", from, err
+	}
+	return ohlc.Pair, from, nil
+}
+
+// backfillTrades adds the trades for pair since the unix time since to b.
+// Trades b has already seen are skipped by their id.
+func backfillTrades(ctx context.Context, k Kraken, b *CandleBuilder, pair string, since int64) error {
+	cursor := strconv.FormatInt(since, 10)
+	for {
+		trades, err := k.GetRecentTrades(ctx, pair, cursor)
+		if err != nil {
+			return err
+		}
+		for _, t := range trades.Trades {
+			price, err := t.Price.Float64()
+			if err != nil {
+				return fmt.Errorf("parse trade price: %w", err)
+			}
+			volume, err := t.Volume.Float64()
+			if err != nil {
+				return fmt.Errorf("parse trade volume: %w", err)
+			}
+			b.AddTrade(price, volume, helpers.UnixTimestampToUTCTime(t.Time), t.TradeID)
+		}
+		if len(trades.Trades) < tradesPageSize || trades.Last == cursor {
+			return nil
+		}
+		cursor = trades.Last
+	}
+}
+
+// lastTrade returns the unix time of the newest trade added.
+func (b *CandleBuilder) lastTrade() int64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.lastTradeTime
+}
+
+// clockOf returns the clock k was created with, or time.Now for other
+// implementations of Kraken.
+func clockOf(k Kraken) func() time.Time {
+	if c, ok := k.(interface{ clock() time.Time }); ok {
+		return c.clock
+	}
+	return time.Now
+}
+
+func (k *kraken) clock() time.Time {
+	return k.now()
+}
+
+// baseInterval returns the largest Kraken interval, in minutes, that divides
+// interval, or 0 if there is none.
+func baseInterval(interval time.Duration) uint16 {
+	for _, m := range slices.Backward(OHLCIntervals) {
+		if interval%(time.Duration(m)*time.Minute) == 0 {
+			return m
+		}
+	}
+	return 0
+}
+
+// GetCandles returns candles of any interval, shaped like GetOHCLData's.
+// Intervals Kraken serves are passed straight through.
+func (k *kraken) GetCandles(ctx context.Context, pair string, interval time.Duration, since int64) (*OHCLResult, error) {
+	if interval%time.Minute == 0 && IsOHLCInterval(uint16(interval/time.Minute)) {
+		return k.GetOHCLData(ctx, pair, uint16(interval/time.Minute), since)
+	}
+	b, err := NewCandleBuilder(interval, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error getting candles: %w", err)
+	}
+	key, err := BackfillCandles(ctx, k, b, pair, since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting candles: %w", err)
+	}
+	// Like Kraken's, last is the start of the newest closed candle.
+	return &OHCLResult{
+		Pair: key,
+		Data: b.Candles(),
+		Last: b.start(k.now().Unix()) - int64(interval/time.Second),
+	}, nil
+}
@@ -0,0 +1,90 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCandleBuilder(t *testing.T) {
+	b, err := NewCandleBuilder(2*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("failed creating builder: %v", err)
+	}
+	hour := int64(time.Hour / time.Second)
+	err = b.AddCandles([]OHCLData{
+		{Time: float64(10 * hour), Open: 10, High: 12, Low: 9, Close: 11, Vwap: 10, Volume: 1, Trades: 3},
+		{Time: float64(11 * hour), Open: 11, High: 15, Low: 10, Close: 14, Vwap: 13, Volume: 3, Trades: 5},
+		{Time: float64(12 * hour), Open: 14, High: 14, Low: 13, Close: 13, Vwap: 13.5, Volume: 2, Trades: 1},
+	}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed adding candles: %v", err)
+	}
+	at := time.Unix(13*hour+60, 0)
+	if _, ok := b.AddTrade(16, 2, at, 100); !ok {
+		t.Fatalf("trade rejected")
+	}
+	if _, ok := b.AddTrade(99, 1, at, 100); ok {
+		t.Errorf("duplicate trade accepted")
+	}
+	candles := b.Candles()
+	if len(candles) != 2 {
+		t.Fatalf("expected 2 candles, got %d", len(candles))
+	}
+	want := OHCLData{Time: float64(10 * hour), Open: 10, High: 15, Low: 9, Close: 14, Vwap: 12.25, Volume: 4, Trades: 8}
+	if candles[0] != want {
+		t.Errorf("incorrect resampled candle:\n got %+v\nwant %+v", candles[0], want)
+	}
+	want = OHCLData{Time: float64(12 * hour), Open: 14, High: 16, Low: 13, Close: 16, Vwap: 14.75, Volume: 4, Trades: 2}
+	if candles[1] != want {
+		t.Errorf("incorrect traded candle:\n got %+v\nwant %+v", candles[1], want)
+	}
+	if err := b.AddCandles(nil, 7*time.Minute); err == nil {
+		t.Errorf("expected candles not dividing the interval to be rejected")
+	}
+}
+
+func TestBackfillCandlesTruncatedBase(t *testing.T) {
+	const step = 7 * 60
+	now := int64(1000 * step)
+	// Kraken's 720 candle cap leaves the base candles starting two minutes
+	// into a 7 minute candle.
+	first := now - 100*step + 120
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/OHLC":
+			var candles []string
+			for ts := first; ts <= now; ts += 60 {
+				candles = append(candles, fmt.Sprintf(`[%d,"%d","%d","%d","%d","1","1",1]`, ts, ts, ts, ts, ts))
+			}
+			_, _ = fmt.Fprintf(w, `{"error":[],"result":{"XXBTZUSD":[%s],"last":%d}}`, strings.Join(candles, ","), now)
+		case "/0/public/Trades":
+			t.Errorf("trades paged for the current candle")
+		}
+	}))
+	defer srv.Close()
+	k, err := newClient("", "", WithBaseURL(srv.URL), WithHTTPClient(srv.Client()),
+		WithClock(func() time.Time { return time.Unix(now+30, 0) }))
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	b, _ := NewCandleBuilder(step*time.Second, 0)
+	if _, err := BackfillCandles(context.Background(), k, b, "XBTUSD", 0); err != nil {
+		t.Fatalf("failed backfilling: %v", err)
+	}
+	candles := b.Candles()
+	if len(candles) != 100 {
+		t.Fatalf("expected 99 whole candles and the open one, got %d", len(candles))
+	}
+	start := now - 99*step
+	if c := candles[0]; int64(c.Time) != start || int64(c.Open) != start || c.Trades != 7 {
+		t.Errorf("incorrect first candle: %+v", c)
+	}
+	if c := candles[len(candles)-1]; int64(c.Time) != now || int64(c.Close) != now || c.Trades != 1 {
+		t.Errorf("expected the open candle resampled from Kraken's, got %+v", c)
+	}
+}
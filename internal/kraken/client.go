@@ -2,11 +2,13 @@ package kraken
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"kasegu/external/helpers"
@@ -17,17 +19,47 @@ import (
 const (
 	BaseURL   = "https://api.kraken.com"
 	UserAgent = "KaseguKrakenClient/0.1.0"
+
+	DefaultTimeout = 30 * time.Second
 )
 
 type Kraken interface {
-	GetAccountBalance() (*map[string]string, error)
-	GetOHCLData(pair string, interval uint16) (*map[string]any, error)
-	AddOrder(pair string, volume string, orderType string) error
-	GetTickerInformation(pair string) (*map[string]TickerInfo, error)
+	GetAccountBalance(ctx context.Context) (*map[string]string, error)
+	GetOHCLData(ctx context.Context, pair string, interval uint16, since int64) (*OHCLResult, error)
+	// GetCandles is GetOHCLData for any whole number of minutes, resampling
+	// the intervals Kraken doesn't serve from smaller candles.
+	GetCandles(ctx context.Context, pair string, interval time.Duration, since int64) (*OHCLResult, error)
+	AddOrder(ctx context.Context, order *OrderRequest) (*AddOrderResult, error)
+	GetTickerInformation(ctx context.Context, pair string) (*map[string]TickerInfo, error)
+	GetOrderBook(ctx context.Context, pair string, count uint16) (*OrderBook, error)
+	GetRecentTrades(ctx context.Context, pair string, since string) (*TradesResult, error)
+	GetRecentSpreads(ctx context.Context, pair string, since int64) (*SpreadsResult, error)
+	GetAssetPairs(ctx context.Context) (*map[string]AssetPair, error)
+	GetAssets(ctx context.Context) (*map[string]AssetInfo, error)
+	AssetPair(ctx context.Context, pair string) (*AssetPair, error)
+	Asset(ctx context.Context, asset string) (*AssetInfo, error)
+	OpenOrders(ctx context.Context, params *OpenOrdersParams) (*map[string]OrderInfo, error)
+	ClosedOrders(ctx context.Context, params *ClosedOrdersParams) (*ClosedOrdersResult, error)
+	QueryOrders(ctx context.Context, params *QueryOrdersParams) (*map[string]OrderInfo, error)
+	CancelOrder(ctx context.Context, params *CancelOrderParams) (*CancelOrderResult, error)
+	CancelAll(ctx context.Context) (*CancelAllResult, error)
+	EditOrder(ctx context.Context, params *EditOrderParams) (*EditOrderResult, error)
+	AmendOrder(ctx context.Context, params *AmendOrderParams) (*AmendOrderResult, error)
+	AddOrderBatch(ctx context.Context, pair string, orders []OrderRequest) (*[]BatchOrderResult, error)
+	CancelAllOrdersAfter(ctx context.Context, timeout uint32) (*CancelAllOrdersAfterResult, error)
+	GetWebSocketsToken(ctx context.Context) (*WebSocketsToken, error)
 }
 type kraken struct {
-	apiKey     string
-	privateKey string
+	apiKey      string
+	privateKey  string
+	baseURL     string
+	wsURL       string
+	wsAuthURL   string
+	httpClient  *http.Client
+	now         func() time.Time
+	metadata    *metadataCache
+	dryRun      bool
+	retryPolicy RetryPolicy
 }
 
 type requestParams struct {
@@ -40,10 +72,6 @@ type requestParams struct {
 	environment string
 }
 
-func getNonce() string {
-	return fmt.Sprint(time.Now().UnixMilli())
-}
-
 func getSignature(privateKey string, data string, nonce string, path string) (string, error) {
 	message := sha256.New()
 	message.Write([]byte(nonce + data))
@@ -74,14 +102,11 @@ func generateRequest(c *requestParams) (*http.Request, error) {
 	var nonce any
 	bodyMap := c.body
 	if len(c.publicKey) > 0 {
-		if bodyMap == nil {
-			bodyMap = make(map[string]any)
-		}
+		// Nonces come from the key's nonceSource so requests stay ordered.
 		var ok bool
 		nonce, ok = bodyMap["nonce"]
 		if !ok {
-			nonce = getNonce()
-			bodyMap["nonce"] = nonce
+			return nil, fmt.Errorf("private request to %s has no nonce", c.path)
 		}
 	}
 	headers := make(http.Header)
@@ -113,25 +138,98 @@ func generateRequest(c *requestParams) (*http.Request, error) {
 	return request, nil
 }
 
-func request(rp *requestParams) (*http.Response, error) {
+func (k *kraken) request(ctx context.Context, rp *requestParams) (*http.Response, error) {
+	cost := 1.0
+	if len(rp.publicKey) > 0 {
+		cost = restCost(rp.path)
+	}
+	if err := governorFor(rp.publicKey).waitREST(ctx, cost); err != nil {
+		return nil, err
+	}
+	if len(rp.publicKey) > 0 {
+		nonces := nonceSourceFor(rp.publicKey)
+		release, err := nonces.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		if rp.body == nil {
+			rp.body = make(map[string]any)
+		}
+		rp.body["nonce"] = nonces.next(k.now())
+	}
 	req, err := generateRequest(rp)
 	if err != nil {
 		return nil, err
 	}
-	return http.DefaultClient.Do(req)
+	return k.httpClient.Do(req.WithContext(ctx))
+}
+
+type response[T any] struct {
+	Error  []string `json:"error"`
+	Result T        `json:"result"`
+}
+
+func requestResult[T any](ctx context.Context, k *kraken, rp *requestParams) (*T, error) {
+	var result *T
+	err := k.withRetry(ctx, !nonIdempotentPaths[rp.path], func() error {
+		var err error
+		result, err = requestResultOnce[T](ctx, k, rp)
+		return err
+	})
+	return result, err
+}
+
+func requestResultOnce[T any](ctx context.Context, k *kraken, rp *requestParams) (*T, error) {
+	resp, err := k.request(ctx, rp)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	defer helpers.CheckedClose(resp.Body)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, &Error{Category: CategoryService, Message: resp.Status, kind: ErrServiceUnavailable}
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	var r response[T]
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("json unmarshal: %w", err)
+	}
+	if err := parseErrors(r.Error); err != nil {
+		if errors.Is(err, ErrRateLimited) {
+			governorFor(rp.publicKey).rateLimited()
+		}
+		return nil, err
+	}
+	return &r.Result, nil
 }
 
-func NewClient(apiKeyEnv string, privateKeyEnv string) (Kraken, error) {
-	kClient, err := newClient(apiKeyEnv, privateKeyEnv)
+func NewClient(apiKeyEnv string, privateKeyEnv string, opts ...Option) (Kraken, error) {
+	kClient, err := newClient(apiKeyEnv, privateKeyEnv, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return kClient, nil
 }
 
-func newClient(apiKeyEnv string, privateKeyEnv string) (*kraken, error) {
-	return &kraken{
-		apiKey:     apiKeyEnv,
-		privateKey: privateKeyEnv,
-	}, nil
+func newClient(apiKeyEnv string, privateKeyEnv string, opts ...Option) (*kraken, error) {
+	k := &kraken{
+		apiKey:      apiKeyEnv,
+		privateKey:  privateKeyEnv,
+		baseURL:     BaseURL,
+		wsURL:       PublicWSURL,
+		wsAuthURL:   PrivateWSURL,
+		httpClient:  &http.Client{Timeout: DefaultTimeout},
+		now:         time.Now,
+		metadata:    newMetadataCache(),
+		retryPolicy: DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		if err := opt(k); err != nil {
+			return nil, fmt.Errorf("apply option: %w", err)
+		}
+	}
+	return k, nil
 }
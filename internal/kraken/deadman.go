@@ -0,0 +1,103 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DeadManSwitch keeps Kraken's CancelAllOrdersAfter timer armed while there
+// are resting orders, so they get cancelled if the process stops refreshing it.
+type DeadManSwitch interface {
+	Start()
+	// Stop ends the refresh loop. The timer on Kraken is left armed, so any
+	// resting orders are still cancelled once it expires.
+	Stop()
+}
+
+type deadManSwitch struct {
+	kClient  Kraken
+	interval time.Duration
+	timeout  time.Duration
+	armed    bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+	sync.Mutex
+}
+
+func NewDeadManSwitch(k Kraken, interval time.Duration, timeout time.Duration) (DeadManSwitch, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("dead man's switch interval must be positive")
+	}
+	if timeout <= interval {
+		return nil, fmt.Errorf("dead man's switch timeout must be greater than its interval")
+	}
+	return &deadManSwitch{
+		kClient:  k,
+		interval: interval,
+		timeout:  timeout,
+	}, nil
+}
+
+func (d *deadManSwitch) Start() {
+	d.Lock()
+	defer d.Unlock()
+	if d.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+	go d.run(ctx)
+}
+
+func (d *deadManSwitch) Stop() {
+	d.Lock()
+	defer d.Unlock()
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	<-d.done
+	d.cancel = nil
+}
+
+func (d *deadManSwitch) run(ctx context.Context) {
+	defer close(d.done)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	d.refresh(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			d.refresh(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *deadManSwitch) refresh(ctx context.Context) {
+	orders, err := d.kClient.OpenOrders(ctx, nil)
+	if err != nil {
+		log.Printf("dead man's switch could not get open orders: %v", err)
+		return
+	}
+	if len(*orders) == 0 {
+		if d.armed {
+			if _, err := d.kClient.CancelAllOrdersAfter(ctx, 0); err != nil {
+				log.Printf("dead man's switch could not disarm: %v", err)
+				return
+			}
+			d.armed = false
+		}
+		return
+	}
+	if _, err := d.kClient.CancelAllOrdersAfter(ctx, uint32(d.timeout.Seconds())); err != nil {
+		log.Printf("dead man's switch could not arm: %v", err)
+		return
+	}
+	d.armed = true
+}
@@ -0,0 +1,76 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeadManSwitchRefresh(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		open     bool
+		timeouts []float64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/0/private/OpenOrders":
+			if open {
+				_, _ = w.Write([]byte(`{"error":[],"result":{"open":{"OABC-123":{"status":"open"}}}}`))
+			} else {
+				_, _ = w.Write([]byte(`{"error":[],"result":{"open":{}}}`))
+			}
+		case "/0/private/CancelAllOrdersAfter":
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			timeout, _ := body["timeout"].(float64)
+			timeouts = append(timeouts, timeout)
+			_, _ = w.Write([]byte(`{"error":[],"result":{"currentTime":"","triggerTime":""}}`))
+		}
+	}))
+	defer srv.Close()
+	k, err := NewClient("deadman-test", "a2V5", WithBaseURL(srv.URL), WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	dms, err := NewDeadManSwitch(k, 20*time.Second, 60*time.Second)
+	if err != nil {
+		t.Fatalf("failed creating switch: %v", err)
+	}
+	d := dms.(*deadManSwitch)
+	steps := []struct {
+		name string
+		open bool
+		want []float64
+	}{
+		{"no open orders", false, nil},
+		{"orders opened", true, []float64{60}},
+		{"orders still open", true, []float64{60, 60}},
+		{"orders gone", false, []float64{60, 60, 0}},
+		{"still no orders", false, []float64{60, 60, 0}},
+	}
+	for _, s := range steps {
+		mu.Lock()
+		open = s.open
+		mu.Unlock()
+		d.refresh(context.Background())
+		mu.Lock()
+		got := append([]float64(nil), timeouts...)
+		mu.Unlock()
+		if len(got) != len(s.want) {
+			t.Fatalf("%s: expected CancelAllOrdersAfter calls %v, got %v", s.name, s.want, got)
+		}
+		for i := range got {
+			if got[i] != s.want[i] {
+				t.Errorf("%s: expected CancelAllOrdersAfter calls %v, got %v", s.name, s.want, got)
+				break
+			}
+		}
+	}
+}
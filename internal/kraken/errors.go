@@ -0,0 +1,128 @@
+package kraken
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	CategoryGeneral = "EGeneral"
+	CategoryAPI     = "EAPI"
+	CategoryQuery   = "EQuery"
+	CategoryOrder   = "EOrder"
+	CategoryTrade   = "ETrade"
+	CategoryFunding = "EFunding"
+	CategoryService = "EService"
+	CategorySession = "ESession"
+)
+
+var (
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrInvalidNonce       = errors.New("invalid nonce")
+	ErrServiceUnavailable = errors.New("service unavailable")
+	ErrInvalidKey         = errors.New("invalid key")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrInvalidArguments   = errors.New("invalid arguments")
+	ErrUnknownOrder       = errors.New("unknown order")
+	ErrUnknownAssetPair   = errors.New("unknown asset pair")
+	ErrOrderMinimum       = errors.New("order minimum not met")
+)
+
+var (
+	errorKinds = map[string]error{
+		"EOrder:Insufficient funds":    ErrInsufficientFunds,
+		"EFunding:Insufficient funds":  ErrInsufficientFunds,
+		"EAPI:Rate limit exceeded":     ErrRateLimited,
+		"EOrder:Rate limit exceeded":   ErrRateLimited,
+		"EGeneral:Too many requests":   ErrRateLimited,
+		"EAPI:Invalid nonce":           ErrInvalidNonce,
+		"EService:Unavailable":         ErrServiceUnavailable,
+		"EService:Busy":                ErrServiceUnavailable,
+		"EGeneral:Temporary lockout":   ErrRateLimited,
+		"EAPI:Invalid key":             ErrInvalidKey,
+		"EAPI:Invalid signature":       ErrInvalidKey,
+		"EGeneral:Permission denied":   ErrPermissionDenied,
+		"EGeneral:Invalid arguments":   ErrInvalidArguments,
+		"EOrder:Unknown order":         ErrUnknownOrder,
+		"EQuery:Unknown asset pair":    ErrUnknownAssetPair,
+		"EOrder:Order minimum not met": ErrOrderMinimum,
+		"EOrder:Cost minimum not met":  ErrOrderMinimum,
+	}
+)
+
+// Error is a single entry of the error array Kraken returns, e.g.
+// "EOrder:Insufficient funds". Known errors unwrap to one of the Err
+// sentinels so callers can use errors.Is.
+type Error struct {
+	Category string
+	Message  string
+	kind     error
+}
+
+func (e *Error) Error() string {
+	return e.Category + ":" + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// Errors holds every error Kraken returned for a single call.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i := range e {
+		s[i] = e[i].Error()
+	}
+	return strings.Join(s, ",")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i := range e {
+		errs[i] = e[i]
+	}
+	return errs
+}
+
+func parseError(s string) *Error {
+	category, message, _ := strings.Cut(s, ":")
+	e := &Error{Category: category, Message: message}
+	for key, kind := range errorKinds {
+		// Some messages carry a detail suffix, e.g. "EGeneral:Invalid arguments:volume".
+		if s == key || strings.HasPrefix(s, key+":") {
+			e.kind = kind
+			break
+		}
+	}
+	return e
+}
+
+func parseErrors(msgs []string) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	errs := make(Errors, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = parseError(msg)
+	}
+	return errs
+}
+
+// HasCategory reports whether err contains a Kraken error of the given
+// category, e.g. CategoryOrder.
+func HasCategory(err error, category string) bool {
+	var errs Errors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			if e.Category == category {
+				return true
+			}
+		}
+		return false
+	}
+	var e *Error
+	return errors.As(err, &e) && e.Category == category
+}
@@ -0,0 +1,27 @@
+package kraken
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	err := fmt.Errorf("error adding order: %w", parseErrors([]string{
+		"EGeneral:Invalid arguments:volume",
+		"EOrder:Insufficient funds",
+	}))
+	if !errors.Is(err, ErrInsufficientFunds) || !errors.Is(err, ErrInvalidArguments) {
+		t.Errorf("missing sentinel: %v", err)
+	}
+	if errors.Is(err, ErrRateLimited) {
+		t.Errorf("unexpected sentinel: %v", err)
+	}
+	if !HasCategory(err, CategoryOrder) || HasCategory(err, CategoryService) {
+		t.Errorf("incorrect category: %v", err)
+	}
+	var kErr *Error
+	if !errors.As(err, &kErr) || kErr.Message != "Invalid arguments:volume" {
+		t.Errorf("incorrect error: %v", kErr)
+	}
+}
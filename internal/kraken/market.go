@@ -0,0 +1,256 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Decimal keeps a price or volume exactly as Kraken sent it so no precision
+// is lost before it is needed.
+type Decimal string
+
+func (d Decimal) Float64() (float64, error) {
+	return strconv.ParseFloat(string(d), 64)
+}
+
+// UnmarshalJSON accepts decimals sent as strings or as JSON numbers, keeping a
+// number's text as it was written.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*d = Decimal(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*d = Decimal(n)
+	return nil
+}
+
+type BookLevel struct {
+	Price     Decimal
+	Volume    Decimal
+	Timestamp int64
+}
+
+// UnmarshalJSON reads the [price, volume, timestamp] tuples of the REST book
+// as well as the {"price", "qty"} objects of the websocket book channel.
+func (b *BookLevel) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		var l struct {
+			Price Decimal `json:"price"`
+			Qty   Decimal `json:"qty"`
+		}
+		if err := json.Unmarshal(data, &l); err != nil {
+			return err
+		}
+		b.Price, b.Volume = l.Price, l.Qty
+		return nil
+	}
+	return unmarshalTuple(data, &b.Price, &b.Volume, &b.Timestamp)
+}
+
+func (b BookLevel) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{b.Price, b.Volume, b.Timestamp})
+}
+
+type OrderBook struct {
+	Pair string      `json:"pair"`
+	Asks []BookLevel `json:"asks"`
+	Bids []BookLevel `json:"bids"`
+}
+
+// EstimateFill walks the book to find the average price a market order of
+// volume on side would fill at.
+func (ob *OrderBook) EstimateFill(side string, volume float64) (float64, error) {
+	if !(volume > 0) {
+		return 0, fmt.Errorf("volume must be positive, got %v", volume)
+	}
+	levels := ob.Asks
+	if side == SideSell {
+		levels = ob.Bids
+	}
+	remaining := volume
+	var cost float64
+	for _, l := range levels {
+		p, err := l.Price.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("parse price: %w", err)
+		}
+		v, err := l.Volume.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("parse volume: %w", err)
+		}
+		fill := min(v, remaining)
+		cost += fill * p
+		remaining -= fill
+		if remaining <= 0 {
+			return cost / volume, nil
+		}
+	}
+	return 0, fmt.Errorf("book too shallow to fill %v", volume)
+}
+
+func (k *kraken) GetOrderBook(ctx context.Context, pair string, count uint16) (*OrderBook, error) {
+	query := map[string]any{
+		"pair": pair,
+	}
+	if count > 0 {
+		query["count"] = count
+	}
+	result, err := requestResult[map[string]OrderBook](ctx, k, &requestParams{
+		method:      "GET",
+		path:        "/0/public/Depth",
+		query:       query,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting order book: %w", err)
+	}
+	for key, book := range *result {
+		book.Pair = key
+		return &book, nil
+	}
+	return nil, fmt.Errorf("error getting order book: no book for %s", pair)
+}
+
+type Trade struct {
+	Price     Decimal `json:"price"`
+	Volume    Decimal `json:"volume"`
+	Time      float64 `json:"time"`
+	Side      string  `json:"side"`
+	OrderType string  `json:"ordertype"`
+	Misc      string  `json:"misc"`
+	TradeID   int64   `json:"trade_id"`
+}
+
+func (t *Trade) UnmarshalJSON(data []byte) error {
+	var side, orderType string
+	if err := unmarshalTuple(data, &t.Price, &t.Volume, &t.Time, &side, &orderType, &t.Misc, &t.TradeID); err != nil {
+		return err
+	}
+	t.Side = SideBuy
+	if side == "s" {
+		t.Side = SideSell
+	}
+	t.OrderType = OrderTypeLimit
+	if orderType == "m" {
+		t.OrderType = OrderTypeMarket
+	}
+	return nil
+}
+
+type TradesResult struct {
+	Pair   string  `json:"pair"`
+	Trades []Trade `json:"trades"`
+	// Last is the cursor to pass as since to fetch only newer trades.
+	Last string `json:"last"`
+}
+
+func (k *kraken) GetRecentTrades(ctx context.Context, pair string, since string) (*TradesResult, error) {
+	query := map[string]any{
+		"pair": pair,
+	}
+	if since != "" {
+		query["since"] = since
+	}
+	result, err := requestResult[map[string]json.RawMessage](ctx, k, &requestParams{
+		method:      "GET",
+		path:        "/0/public/Trades",
+		query:       query,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting recent trades: %w", err)
+	}
+	var trades TradesResult
+	trades.Pair, err = unmarshalPairResult(*result, &trades.Trades, &trades.Last)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing recent trades: %w", err)
+	}
+	return &trades, nil
+}
+
+type Spread struct {
+	Time int64   `json:"time"`
+	Bid  Decimal `json:"bid"`
+	Ask  Decimal `json:"ask"`
+}
+
+func (s *Spread) UnmarshalJSON(data []byte) error {
+	return unmarshalTuple(data, &s.Time, &s.Bid, &s.Ask)
+}
+
+type SpreadsResult struct {
+	Pair    string   `json:"pair"`
+	Spreads []Spread `json:"spreads"`
+	// Last is the cursor to pass as since to fetch only newer spreads.
+	Last int64 `json:"last"`
+}
+
+func (k *kraken) GetRecentSpreads(ctx context.Context, pair string, since int64) (*SpreadsResult, error) {
+	query := map[string]any{
+		"pair": pair,
+	}
+	if since > 0 {
+		query["since"] = since
+	}
+	result, err := requestResult[map[string]json.RawMessage](ctx, k, &requestParams{
+		method:      "GET",
+		path:        "/0/public/Spread",
+		query:       query,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting recent spreads: %w", err)
+	}
+	var spreads SpreadsResult
+	spreads.Pair, err = unmarshalPairResult(*result, &spreads.Spreads, &spreads.Last)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing recent spreads: %w", err)
+	}
+	return &spreads, nil
+}
+
+// unmarshalPairResult splits results shaped like {"<pair>": [...], "last": ...}
+// and returns the pair name Kraken used.
+func unmarshalPairResult(result map[string]json.RawMessage, data any, last any) (string, error) {
+	var pair string
+	for key, value := range result {
+		if key == "last" {
+			if err := json.Unmarshal(value, last); err != nil {
+				return "", fmt.Errorf("parse cursor: %w", err)
+			}
+			continue
+		}
+		pair = key
+		if err := json.Unmarshal(value, data); err != nil {
+			return "", fmt.Errorf("parse data: %w", err)
+		}
+	}
+	return pair, nil
+}
+
+// unmarshalTuple decodes a JSON array into fields in order.
+func unmarshalTuple(data []byte, fields ...any) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) < len(fields) {
+		return fmt.Errorf("expected %d fields, got %d", len(fields), len(raw))
+	}
+	for i, f := range fields {
+		if err := json.Unmarshal(raw[i], f); err != nil {
+			return fmt.Errorf("field %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package kraken
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTupleDecoding(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		got  any
+		want any
+	}{
+		{
+			name: "book level",
+			data: `["37500.10000","1.250",1616663113]`,
+			got:  &BookLevel{},
+			want: &BookLevel{Price: "37500.10000", Volume: "1.250", Timestamp: 1616663113},
+		},
+		{
+			name: "trade",
+			data: `["37500.1","0.5",1616663113.1234,"s","m","",42]`,
+			got:  &Trade{},
+			want: &Trade{Price: "37500.1", Volume: "0.5", Time: 1616663113.1234, Side: SideSell, OrderType: OrderTypeMarket, TradeID: 42},
+		},
+		{
+			name: "spread",
+			data: `[1616663113,"37500.0","37500.1"]`,
+			got:  &Spread{},
+			want: &Spread{Time: 1616663113, Bid: "37500.0", Ask: "37500.1"},
+		},
+	}
+	for _, tt := range tests {
+		if err := json.Unmarshal([]byte(tt.data), tt.got); err != nil {
+			t.Errorf("%s: failed decoding: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: incorrect decoding:\n got %+v\nwant %+v", tt.name, tt.got, tt.want)
+		}
+	}
+	if err := json.Unmarshal([]byte(`["1.0"]`), &BookLevel{}); err == nil {
+		t.Errorf("expected a short tuple to be rejected")
+	}
+}
+
+func TestUnmarshalPairResult(t *testing.T) {
+	var result map[string]json.RawMessage
+	data := `{"XXBTZUSD":[[1616663113,"37500.0","37500.1"]],"last":1616663113}`
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatalf("failed decoding: %v", err)
+	}
+	var spreads SpreadsResult
+	pair, err := unmarshalPairResult(result, &spreads.Spreads, &spreads.Last)
+	if err != nil {
+		t.Fatalf("failed splitting result: %v", err)
+	}
+	if pair != "XXBTZUSD" || spreads.Last != 1616663113 || len(spreads.Spreads) != 1 {
+		t.Errorf("incorrect result: %s %+v", pair, spreads)
+	}
+}
+
+func TestEstimateFill(t *testing.T) {
+	book := &OrderBook{
+		Asks: []BookLevel{{Price: "100", Volume: "1"}, {Price: "110", Volume: "2"}},
+		Bids: []BookLevel{{Price: "90", Volume: "1"}, {Price: "80", Volume: "1"}},
+	}
+	tests := []struct {
+		name    string
+		side    string
+		volume  float64
+		want    float64
+		wantErr bool
+	}{
+		{name: "within first level", side: SideBuy, volume: 0.5, want: 100},
+		{name: "spanning levels", side: SideBuy, volume: 2, want: 105},
+		{name: "sell side", side: SideSell, volume: 2, want: 85},
+		{name: "deeper than book", side: SideBuy, volume: 4, wantErr: true},
+		{name: "zero volume", side: SideBuy, volume: 0, wantErr: true},
+		{name: "negative volume", side: SideSell, volume: -1, wantErr: true},
+		{name: "nan volume", side: SideSell, volume: math.NaN(), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := book.EstimateFill(tt.side, tt.volume)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed estimating fill: %v", tt.name, err)
+		} else if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
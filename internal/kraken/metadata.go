@@ -0,0 +1,265 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metadataTTL = time.Hour
+
+type AssetPair struct {
+	AltName           string      `json:"altname"`
+	WsName            string      `json:"wsname"`
+	Base              string      `json:"base"`
+	Quote             string      `json:"quote"`
+	PairDecimals      int         `json:"pair_decimals"`
+	CostDecimals      int         `json:"cost_decimals"`
+	LotDecimals       int         `json:"lot_decimals"`
+	LotMultiplier     int         `json:"lot_multiplier"`
+	OrderMin          Decimal     `json:"ordermin"`
+	CostMin           Decimal     `json:"costmin"`
+	TickSize          Decimal     `json:"tick_size"`
+	Status            string      `json:"status"`
+	LeverageBuy       []int       `json:"leverage_buy"`
+	LeverageSell      []int       `json:"leverage_sell"`
+	Fees              [][]float64 `json:"fees"`
+	FeesMaker         [][]float64 `json:"fees_maker"`
+	FeeVolumeCurrency string      `json:"fee_volume_currency"`
+}
+
+type AssetInfo struct {
+	AssetClass      string  `json:"aclass"`
+	AltName         string  `json:"altname"`
+	Decimals        int     `json:"decimals"`
+	DisplayDecimals int     `json:"display_decimals"`
+	CollateralValue float64 `json:"collateral_value"`
+	Status          string  `json:"status"`
+}
+
+func (k *kraken) GetAssetPairs(ctx context.Context) (*map[string]AssetPair, error) {
+	pairs, err := requestResult[map[string]AssetPair](ctx, k, &requestParams{
+		method:      "GET",
+		path:        "/0/public/AssetPairs",
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting asset pairs: %w", err)
+	}
+	return pairs, nil
+}
+
+func (k *kraken) GetAssets(ctx context.Context) (*map[string]AssetInfo, error) {
+	assets, err := requestResult[map[string]AssetInfo](ctx, k, &requestParams{
+		method:      "GET",
+		path:        "/0/public/Assets",
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting assets: %w", err)
+	}
+	return assets, nil
+}
+
+// metadataCache holds asset pair and asset metadata indexed by every name
+// Kraken accepts for them (key, altname and wsname).
+type metadataCache struct {
+	pairs         map[string]AssetPair
+	assets        map[string]AssetInfo
+	pairsUpdated  time.Time
+	assetsUpdated time.Time
+	sync.Mutex
+}
+
+func newMetadataCache() *metadataCache {
+	return &metadataCache{
+		pairs:  make(map[string]AssetPair),
+		assets: make(map[string]AssetInfo),
+	}
+}
+
+// AssetPair returns the cached metadata for pair, refreshing it when stale.
+func (k *kraken) AssetPair(ctx context.Context, pair string) (*AssetPair, error) {
+	k.metadata.Lock()
+	defer k.metadata.Unlock()
+	if time.Since(k.metadata.pairsUpdated) > metadataTTL {
+		pairs, err := k.GetAssetPairs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		k.metadata.pairs = make(map[string]AssetPair, len(*pairs)*3)
+		for key, p := range *pairs {
+			k.metadata.pairs[key] = p
+			k.metadata.pairs[p.AltName] = p
+			if p.WsName != "" {
+				k.metadata.pairs[p.WsName] = p
+			}
+		}
+		k.metadata.pairsUpdated = time.Now()
+	}
+	p, ok := k.metadata.pairs[pair]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAssetPair, pair)
+	}
+	return &p, nil
+}
+
+// Asset returns the cached metadata for asset, refreshing it when stale.
+func (k *kraken) Asset(ctx context.Context, asset string) (*AssetInfo, error) {
+	k.metadata.Lock()
+	defer k.metadata.Unlock()
+	if time.Since(k.metadata.assetsUpdated) > metadataTTL {
+		assets, err := k.GetAssets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		k.metadata.assets = make(map[string]AssetInfo, len(*assets)*2)
+		for key, a := range *assets {
+			k.metadata.assets[key] = a
+			k.metadata.assets[a.AltName] = a
+		}
+		k.metadata.assetsUpdated = time.Now()
+	}
+	a, ok := k.metadata.assets[asset]
+	if !ok {
+		return nil, fmt.Errorf("unknown asset: %s", asset)
+	}
+	return &a, nil
+}
+
+// normalizeOrder rounds the order's volume and prices to the precision Kraken
+// allows for its pair and checks it against the pair's minimums and status.
+func (k *kraken) normalizeOrder(ctx context.Context, o *OrderRequest) error {
+	p, err := k.AssetPair(ctx, o.Pair)
+	if err != nil {
+		return err
+	}
+	switch p.Status {
+	case "cancel_only":
+		return fmt.Errorf("%s only accepts cancellations", o.Pair)
+	case "limit_only", "post_only":
+		if o.OrderType != OrderTypeLimit || (p.Status == "post_only" && !o.PostOnly) {
+			return fmt.Errorf("%s is in %s mode", o.Pair, p.Status)
+		}
+	}
+	o.Volume, err = p.normalizeVolume(o.Volume)
+	if err != nil {
+		return err
+	}
+	o.Price, err = p.normalizePrice(o.Price)
+	if err != nil {
+		return err
+	}
+	o.Price2, err = p.normalizePrice(o.Price2)
+	if err != nil {
+		return err
+	}
+	if p.CostMin == "" {
+		return nil
+	}
+	price, err := k.costPrice(ctx, o)
+	if err != nil {
+		return err
+	}
+	return p.checkCost(o.Volume, price)
+}
+
+// costPrice returns the price the order's cost is judged at: the limit price
+// of limit orders, the trigger price of stop orders that fill at market, and
+// the price a market order would take from the ticker.
+func (k *kraken) costPrice(ctx context.Context, o *OrderRequest) (string, error) {
+	switch o.OrderType {
+	case OrderTypeLimit, OrderTypeStopLoss, OrderTypeTakeProfit:
+		return o.Price, nil
+	case OrderTypeStopLossLimit, OrderTypeTakeProfitLimit:
+		return o.Price2, nil
+	case OrderTypeMarket:
+		ti, err := k.GetTickerInformation(ctx, o.Pair)
+		if err != nil {
+			return "", fmt.Errorf("error getting price for cost check: %w", err)
+		}
+		for _, t := range *ti {
+			quote := t.A
+			if o.Side == SideSell {
+				quote = t.B
+			}
+			if len(quote) == 0 {
+				break
+			}
+			return quote[0], nil
+		}
+		return "", fmt.Errorf("error getting price for cost check: no ticker for %s", o.Pair)
+	}
+	return "", nil
+}
+
+// normalizeVolume truncates volume to lot_decimals, so we never send more
+// than was asked for, and checks it against ordermin.
+func (p *AssetPair) normalizeVolume(volume string) (string, error) {
+	v, err := strconv.ParseFloat(volume, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid volume %s: %w", volume, err)
+	}
+	volume = truncateDecimals(strconv.FormatFloat(v, 'f', -1, 64), p.LotDecimals)
+	if p.OrderMin != "" {
+		v, _ = strconv.ParseFloat(volume, 64)
+		m, err := p.OrderMin.Float64()
+		if err == nil && v < m {
+			return "", fmt.Errorf("%w: volume %s is below %s", ErrOrderMinimum, volume, p.OrderMin)
+		}
+	}
+	return volume, nil
+}
+
+// normalizePrice rounds an absolute price to tick_size and pair_decimals.
+// Relative prices such as "+50" or "2%" are left untouched.
+func (p *AssetPair) normalizePrice(price string) (string, error) {
+	if price == "" || strings.ContainsAny(price[:1], "+-#") || strings.HasSuffix(price, "%") {
+		return price, nil
+	}
+	v, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid price %s: %w", price, err)
+	}
+	if tick, err := p.TickSize.Float64(); err == nil && tick > 0 {
+		v = math.Round(v/tick) * tick
+	}
+	return strconv.FormatFloat(v, 'f', p.PairDecimals, 64), nil
+}
+
+func (p *AssetPair) checkCost(volume string, price string) error {
+	if p.CostMin == "" || price == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(volume, 64)
+	if err != nil {
+		return nil
+	}
+	pr, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return nil
+	}
+	m, err := p.CostMin.Float64()
+	if err == nil && v*pr < m {
+		return fmt.Errorf("%w: cost %v is below %s", ErrOrderMinimum, v*pr, p.CostMin)
+	}
+	return nil
+}
+
+func truncateDecimals(s string, decimals int) string {
+	whole, frac, ok := strings.Cut(s, ".")
+	if !ok {
+		return s
+	}
+	if len(frac) > decimals {
+		frac = frac[:decimals]
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
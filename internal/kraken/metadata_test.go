@@ -0,0 +1,65 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAssetPairNormalization(t *testing.T) {
+	p := &AssetPair{LotDecimals: 4, PairDecimals: 2, OrderMin: "0.5", CostMin: "10", TickSize: "0.05"}
+	v, err := p.normalizeVolume("1.23456789")
+	if err != nil || v != "1.2345" {
+		t.Errorf("incorrect volume: %s, %v", v, err)
+	}
+	if _, err := p.normalizeVolume("0.1"); !errors.Is(err, ErrOrderMinimum) {
+		t.Errorf("expected order minimum error, got %v", err)
+	}
+	pr, err := p.normalizePrice("37500.1234")
+	if err != nil || pr != "37500.10" {
+		t.Errorf("incorrect price: %s, %v", pr, err)
+	}
+	if pr, _ := p.normalizePrice("+2%"); pr != "+2%" {
+		t.Errorf("relative price changed: %s", pr)
+	}
+	if err := p.checkCost("0.5", "10"); !errors.Is(err, ErrOrderMinimum) {
+		t.Errorf("expected cost minimum error, got %v", err)
+	}
+}
+
+func TestNormalizeOrderCost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/AssetPairs":
+			_, _ = w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","wsname":"XBT/USD","pair_decimals":1,"lot_decimals":8,"ordermin":"0.0001","costmin":"0.5","tick_size":"0.1","status":"online"}}}`))
+		case "/0/public/Ticker":
+			_, _ = w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"a":["40000.0","1","1.000"],"b":["39990.0","1","1.000"]}}}`))
+		}
+	}))
+	defer srv.Close()
+	k, err := newClient("", "", WithBaseURL(srv.URL), WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	tests := []struct {
+		name  string
+		order OrderRequest
+		ok    bool
+	}{
+		{"market above cost", OrderRequest{Pair: "XBTUSD", Side: SideBuy, OrderType: OrderTypeMarket, Volume: "0.0001"}, true},
+		{"market below cost", OrderRequest{Pair: "XBTUSD", Side: SideSell, OrderType: OrderTypeMarket, Volume: "0.00001"}, false},
+		{"limit below cost", OrderRequest{Pair: "XBTUSD", Side: SideBuy, OrderType: OrderTypeLimit, Volume: "0.0001", Price: "1000"}, false},
+		{"stop-loss-limit below cost", OrderRequest{Pair: "XBTUSD", Side: SideSell, OrderType: OrderTypeStopLossLimit, Volume: "0.0001", Price: "40000", Price2: "1000"}, false},
+		{"stop-loss-limit above cost", OrderRequest{Pair: "XBTUSD", Side: SideSell, OrderType: OrderTypeStopLossLimit, Volume: "0.0001", Price: "1000", Price2: "40000"}, true},
+	}
+	for _, tt := range tests {
+		err := k.normalizeOrder(context.Background(), &tt.order)
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		} else if !tt.ok && !errors.Is(err, ErrOrderMinimum) {
+			t.Errorf("%s: expected order minimum error, got %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"kasegu/external/helpers"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	nonceSources   = make(map[string]*nonceSource)
+	nonceSourcesMu sync.Mutex
+)
+
+// nonceSource hands out strictly increasing nonces for a single API key. It is
+// shared by every client using that key so their private calls never collide.
+type nonceSource struct {
+	last     int64
+	window   time.Duration
+	filename string
+	// inflight serializes private requests when Kraken has no nonce window
+	// configured, since requests overtaking each other would be rejected.
+	inflight chan struct{}
+	sync.Mutex
+}
+
+func nonceSourceFor(apiKey string) *nonceSource {
+	nonceSourcesMu.Lock()
+	defer nonceSourcesMu.Unlock()
+	n, ok := nonceSources[apiKey]
+	if !ok {
+		n = &nonceSource{inflight: make(chan struct{}, 1)}
+		nonceSources[apiKey] = n
+	}
+	return n
+}
+
+func (n *nonceSource) next(now time.Time) string {
+	n.Lock()
+	defer n.Unlock()
+	nonce := now.UnixMilli()
+	if nonce <= n.last {
+		nonce = n.last + 1
+	}
+	n.last = nonce
+	if n.filename != "" {
+		if err := helpers.SerializeData(&n.last, n.filename); err != nil {
+			log.Printf("failed persisting kraken nonce: %v", err)
+		}
+	}
+	return strconv.FormatInt(nonce, 10)
+}
+
+// acquire must be held from generating a nonce until its request has been
+// answered. It returns the function that releases it.
+func (n *nonceSource) acquire(ctx context.Context) (func(), error) {
+	n.Lock()
+	window := n.window
+	n.Unlock()
+	if window > 0 {
+		return func() {}, nil
+	}
+	select {
+	case n.inflight <- struct{}{}:
+		return func() { <-n.inflight }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (n *nonceSource) setWindow(window time.Duration) {
+	n.Lock()
+	defer n.Unlock()
+	n.window = window
+}
+
+// setPersistence stores every nonce in filename and resumes from the value
+// already there, so a restart with a lagging clock can't reuse old nonces.
+func (n *nonceSource) setPersistence(filename string) error {
+	n.Lock()
+	defer n.Unlock()
+	n.filename = filename
+	if !helpers.IsThereSerializedData(filename) {
+		return nil
+	}
+	last, err := helpers.UnserializeData[int64](filename)
+	if err != nil {
+		return fmt.Errorf("failed loading kraken nonce: %w", err)
+	}
+	if *last > n.last {
+		n.last = *last
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package kraken
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNonceSourceStrictlyIncreasing(t *testing.T) {
+	n := &nonceSource{}
+	now := time.UnixMilli(1616492376594)
+	var wg sync.WaitGroup
+	nonces := make(chan string, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonces <- n.next(now)
+		}()
+	}
+	wg.Wait()
+	close(nonces)
+	seen := make(map[string]bool)
+	for nonce := range nonces {
+		if seen[nonce] {
+			t.Errorf("duplicate nonce: %s", nonce)
+		}
+		seen[nonce] = true
+	}
+	if last := n.next(now); last != strconv.FormatInt(now.UnixMilli()+100, 10) {
+		t.Errorf("incorrect nonce after burst: %s", last)
+	}
+}
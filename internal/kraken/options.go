@@ -0,0 +1,129 @@
+package kraken
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type Option func(k *kraken) error
+
+// WithBaseURL points REST calls at endpoint instead of BaseURL.
+func WithBaseURL(endpoint string) Option {
+	return func(k *kraken) error {
+		if _, err := url.ParseRequestURI(endpoint); err != nil {
+			return fmt.Errorf("invalid base url %s: %w", endpoint, err)
+		}
+		k.baseURL = endpoint
+		return nil
+	}
+}
+
+// WithWebSocketURL points websocket connections at endpoint instead of PublicWSURL.
+func WithWebSocketURL(endpoint string) Option {
+	return func(k *kraken) error {
+		if _, err := url.ParseRequestURI(endpoint); err != nil {
+			return fmt.Errorf("invalid websocket url %s: %w", endpoint, err)
+		}
+		k.wsURL = endpoint
+		return nil
+	}
+}
+
+// WithAuthWebSocketURL points authenticated websocket connections at endpoint
+// instead of PrivateWSURL.
+func WithAuthWebSocketURL(endpoint string) Option {
+	return func(k *kraken) error {
+		if _, err := url.ParseRequestURI(endpoint); err != nil {
+			return fmt.Errorf("invalid websocket url %s: %w", endpoint, err)
+		}
+		k.wsAuthURL = endpoint
+		return nil
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(k *kraken) error {
+		if client == nil {
+			return fmt.Errorf("http client is nil")
+		}
+		k.httpClient = client
+		return nil
+	}
+}
+
+// WithTransport keeps the current client settings but sends requests through
+// transport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(k *kraken) error {
+		c := *k.httpClient
+		c.Transport = transport
+		k.httpClient = &c
+		return nil
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(k *kraken) error {
+		c := *k.httpClient
+		c.Timeout = timeout
+		k.httpClient = &c
+		return nil
+	}
+}
+
+// WithClock replaces time.Now as the clock request nonces are derived from.
+func WithClock(now func() time.Time) Option {
+	return func(k *kraken) error {
+		if now == nil {
+			return fmt.Errorf("clock is nil")
+		}
+		k.now = now
+		return nil
+	}
+}
+
+// WithRateLimitTier sets the limits shared by every client using this
+// client's API key.
+func WithRateLimitTier(tier RateLimitTier) Option {
+	return func(k *kraken) error {
+		SetRateLimitTier(k.apiKey, tier)
+		return nil
+	}
+}
+
+// WithNonceWindow tells the client the nonce window configured on the API key.
+// Without one, private calls sharing the key are sent one at a time so their
+// nonces always arrive in order.
+func WithNonceWindow(window time.Duration) Option {
+	return func(k *kraken) error {
+		nonceSourceFor(k.apiKey).setWindow(window)
+		return nil
+	}
+}
+
+// WithNoncePersistence keeps the last nonce used by the API key in filename so
+// nonces keep increasing across restarts.
+func WithNoncePersistence(filename string) Option {
+	return func(k *kraken) error {
+		return nonceSourceFor(k.apiKey).setPersistence(filename)
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy for transient failures.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(k *kraken) error {
+		k.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithDryRun makes every order placed or edited through the client validate
+// only, so nothing is ever committed.
+func WithDryRun(dryRun bool) Option {
+	return func(k *kraken) error {
+		k.dryRun = dryRun
+		return nil
+	}
+}
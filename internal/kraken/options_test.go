@@ -0,0 +1,41 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientOptions(t *testing.T) {
+	var nonce string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed decoding body: %v", err)
+		}
+		nonce, _ = body["nonce"].(string)
+		_, _ = w.Write([]byte(`{"error":[],"result":{"ZUSD":"100.0"}}`))
+	}))
+	defer srv.Close()
+	k, err := NewClient("options-test", "a2V5",
+		WithBaseURL(srv.URL),
+		WithHTTPClient(srv.Client()),
+		WithClock(func() time.Time { return time.UnixMilli(1616492376594) }),
+	)
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	bal, err := k.GetAccountBalance(context.Background())
+	if err != nil {
+		t.Fatalf("failed getting balance: %v", err)
+	}
+	if (*bal)["ZUSD"] != "100.0" {
+		t.Errorf("incorrect balance: %v", *bal)
+	}
+	if nonce != "1616492376594" {
+		t.Errorf("incorrect nonce: %s", nonce)
+	}
+}
@@ -0,0 +1,684 @@
+package kraken
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+const (
+	OrderTypeMarket          = "market"
+	OrderTypeLimit           = "limit"
+	OrderTypeStopLoss        = "stop-loss"
+	OrderTypeTakeProfit      = "take-profit"
+	OrderTypeStopLossLimit   = "stop-loss-limit"
+	OrderTypeTakeProfitLimit = "take-profit-limit"
+	OrderTypeTrailingStop    = "trailing-stop"
+)
+
+const (
+	TimeInForceGTC = "GTC"
+	TimeInForceIOC = "IOC"
+	TimeInForceGTD = "GTD"
+)
+
+const (
+	OrderStatusPending  = "pending"
+	OrderStatusOpen     = "open"
+	OrderStatusClosed   = "closed"
+	OrderStatusCanceled = "canceled"
+	OrderStatusExpired  = "expired"
+)
+
+type OrderDescription struct {
+	Pair      string `json:"pair"`
+	Type      string `json:"type"`
+	OrderType string `json:"ordertype"`
+	Price     string `json:"price"`
+	Price2    string `json:"price2"`
+	Leverage  string `json:"leverage"`
+	Order     string `json:"order"`
+	Close     string `json:"close"`
+}
+
+type OrderInfo struct {
+	RefID          string           `json:"refid"`
+	UserRef        int32            `json:"userref"`
+	ClientOrderID  string           `json:"cl_ord_id"`
+	Status         string           `json:"status"`
+	Reason         string           `json:"reason"`
+	OpenTime       float64          `json:"opentm"`
+	StartTime      float64          `json:"starttm"`
+	ExpireTime     float64          `json:"expiretm"`
+	CloseTime      float64          `json:"closetm"`
+	Description    OrderDescription `json:"descr"`
+	Volume         string           `json:"vol"`
+	VolumeExecuted string           `json:"vol_exec"`
+	Cost           string           `json:"cost"`
+	Fee            string           `json:"fee"`
+	AveragePrice   string           `json:"price"`
+	StopPrice      string           `json:"stopprice"`
+	LimitPrice     string           `json:"limitprice"`
+	Misc           string           `json:"misc"`
+	OrderFlags     string           `json:"oflags"`
+	Trades         []string         `json:"trades"`
+}
+
+type OpenOrdersParams struct {
+	Trades        bool
+	UserRef       int32
+	ClientOrderID string
+}
+
+func (k *kraken) OpenOrders(ctx context.Context, params *OpenOrdersParams) (*map[string]OrderInfo, error) {
+	body := make(map[string]any)
+	if params != nil {
+		if params.Trades {
+			body["trades"] = true
+		}
+		if params.UserRef != 0 {
+			body["userref"] = params.UserRef
+		}
+		if params.ClientOrderID != "" {
+			body["cl_ord_id"] = params.ClientOrderID
+		}
+	}
+	result, err := requestResult[struct {
+		Open map[string]OrderInfo `json:"open"`
+	}](ctx, k, &requestParams{
+		method:      "POST",
+		path:        "/0/private/OpenOrders",
+		body:        body,
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting open orders: %w", err)
+	}
+	return &result.Open, nil
+}
+
+type ClosedOrdersParams struct {
+	Trades        bool
+	UserRef       int32
+	ClientOrderID string
+	// Start and End accept either a unix timestamp or an order txid.
+	Start     string
+	End       string
+	Offset    uint32
+	CloseTime string
+}
+
+type ClosedOrdersResult struct {
+	Closed map[string]OrderInfo `json:"closed"`
+	Count  uint32               `json:"count"`
+}
+
+func (k *kraken) ClosedOrders(ctx context.Context, params *ClosedOrdersParams) (*ClosedOrdersResult, error) {
+	body := make(map[string]any)
+	if params != nil {
+		if params.Trades {
+			body["trades"] = true
+		}
+		if params.UserRef != 0 {
+			body["userref"] = params.UserRef
+		}
+		if params.ClientOrderID != "" {
+			body["cl_ord_id"] = params.ClientOrderID
+		}
+		if params.Start != "" {
+			body["start"] = params.Start
+		}
+		if params.End != "" {
+			body["end"] = params.End
+		}
+		if params.Offset != 0 {
+			body["ofs"] = params.Offset
+		}
+		if params.CloseTime != "" {
+			body["closetime"] = params.CloseTime
+		}
+	}
+	result, err := requestResult[ClosedOrdersResult](ctx, k, &requestParams{
+		method:      "POST",
+		path:        "/0/private/ClosedOrders",
+		body:        body,
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting closed orders: %w", err)
+	}
+	return result, nil
+}
+
+type QueryOrdersParams struct {
+	TxIDs   []string
+	Trades  bool
+	UserRef int32
+}
+
+func (k *kraken) QueryOrders(ctx context.Context, params *QueryOrdersParams) (*map[string]OrderInfo, error) {
+	if params == nil || len(params.TxIDs) == 0 {
+		return nil, fmt.Errorf("error querying orders: no txids provided")
+	}
+	body := map[string]any{
+		"txid": strings.Join(params.TxIDs, ","),
+	}
+	if params.Trades {
+		body["trades"] = true
+	}
+	if params.UserRef != 0 {
+		body["userref"] = params.UserRef
+	}
+	result, err := requestResult[map[string]OrderInfo](ctx, k, &requestParams{
+		method:      "POST",
+		path:        "/0/private/QueryOrders",
+		body:        body,
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying orders: %w", err)
+	}
+	return result, nil
+}
+
+type OrderRequest struct {
+	Pair      string
+	Side      string
+	OrderType string
+	Volume    string
+	// Price is the limit price for limit orders and the trigger price for
+	// stop-loss, take-profit and their limit variants. For trailing-stop it
+	// is the trailing offset, e.g. "+50" or "+2%".
+	Price string
+	// Price2 is the limit price of stop-loss-limit and take-profit-limit orders.
+	Price2        string
+	Trigger       string
+	TimeInForce   string
+	PostOnly      bool
+	ReduceOnly    bool
+	StartTime     string
+	ExpireTime    string
+	UserRef       int32
+	ClientOrderID string
+	// DryRun asks Kraken to only validate the order. Clients created with
+	// WithDryRun validate every order regardless.
+	DryRun bool
+}
+
+type AddOrderDescription struct {
+	Order string `json:"order"`
+	Close string `json:"close"`
+}
+
+type AddOrderResult struct {
+	Description AddOrderDescription `json:"descr"`
+	TxIDs       []string            `json:"txid"`
+}
+
+func (o *OrderRequest) validate() error {
+	if o.Pair == "" {
+		return fmt.Errorf("pair is required")
+	}
+	if o.Side != SideBuy && o.Side != SideSell {
+		return fmt.Errorf("side %q not supported", o.Side)
+	}
+	if o.Volume == "" {
+		return fmt.Errorf("volume is required")
+	}
+	switch o.OrderType {
+	case OrderTypeMarket:
+	case OrderTypeLimit, OrderTypeStopLoss, OrderTypeTakeProfit, OrderTypeTrailingStop:
+		if o.Price == "" {
+			return fmt.Errorf("price is required for %s orders", o.OrderType)
+		}
+	case OrderTypeStopLossLimit, OrderTypeTakeProfitLimit:
+		if o.Price == "" || o.Price2 == "" {
+			return fmt.Errorf("price and price2 are required for %s orders", o.OrderType)
+		}
+	default:
+		return fmt.Errorf("order type %q not supported", o.OrderType)
+	}
+	if o.PostOnly && o.OrderType != OrderTypeLimit {
+		return fmt.Errorf("post-only is only supported on limit orders")
+	}
+	switch o.TimeInForce {
+	case "", TimeInForceGTC, TimeInForceIOC:
+	case TimeInForceGTD:
+		if o.ExpireTime == "" {
+			return fmt.Errorf("expire time is required for GTD orders")
+		}
+	default:
+		return fmt.Errorf("time in force %q not supported", o.TimeInForce)
+	}
+	return nil
+}
+
+func (o *OrderRequest) body() map[string]any {
+	body := map[string]any{
+		"ordertype": o.OrderType,
+		"type":      o.Side,
+		"pair":      o.Pair,
+		"volume":    o.Volume,
+	}
+	if o.Price != "" {
+		body["price"] = o.Price
+	}
+	if o.Price2 != "" {
+		body["price2"] = o.Price2
+	}
+	if o.Trigger != "" {
+		body["trigger"] = o.Trigger
+	}
+	if o.TimeInForce != "" {
+		body["timeinforce"] = o.TimeInForce
+	}
+	if o.PostOnly {
+		body["oflags"] = "post"
+	}
+	if o.ReduceOnly {
+		body["reduce_only"] = true
+	}
+	if o.StartTime != "" {
+		body["starttm"] = o.StartTime
+	}
+	if o.ExpireTime != "" {
+		body["expiretm"] = o.ExpireTime
+	}
+	if o.UserRef != 0 {
+		body["userref"] = o.UserRef
+	}
+	if o.ClientOrderID != "" {
+		body["cl_ord_id"] = o.ClientOrderID
+	}
+	if o.DryRun {
+		body["validate"] = true
+	}
+	return body
+}
+
+func (k *kraken) AddOrder(ctx context.Context, order *OrderRequest) (*AddOrderResult, error) {
+	if order == nil {
+		return nil, fmt.Errorf("error adding order: no order provided")
+	}
+	if err := order.validate(); err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	normalized := *order
+	if err := k.normalizeOrder(ctx, &normalized); err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	normalized.DryRun = normalized.DryRun || k.dryRun
+	order = &normalized
+	g := governorFor(k.apiKey)
+	if err := g.waitOrder(ctx, order.Pair, 1); err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	rp := &requestParams{
+		method:      "POST",
+		path:        "/0/private/AddOrder",
+		body:        order.body(),
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	}
+	var result *AddOrderResult
+	attempt := 0
+	// Only orders carrying a client order id are retried, after checking the
+	// previous attempt didn't reach the book anyway.
+	err := k.withRetry(ctx, order.ClientOrderID != "" && !order.DryRun, func() error {
+		var err error
+		if attempt > 0 {
+			result, err = k.findClientOrder(ctx, order.ClientOrderID)
+			if err != nil || result != nil {
+				return err
+			}
+		}
+		attempt++
+		result, err = requestResultOnce[AddOrderResult](ctx, k, rp)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	g.orderPlaced(order.Pair, result.TxIDs)
+	return result, nil
+}
+
+// findClientOrder looks for an open or closed order placed with clientOrderID
+// and returns it as if it had just been added, or nil if there is none.
+func (k *kraken) findClientOrder(ctx context.Context, clientOrderID string) (*AddOrderResult, error) {
+	open, err := k.OpenOrders(ctx, &OpenOrdersParams{ClientOrderID: clientOrderID})
+	if err != nil {
+		return nil, err
+	}
+	orders := *open
+	if len(orders) == 0 {
+		closed, err := k.ClosedOrders(ctx, &ClosedOrdersParams{ClientOrderID: clientOrderID})
+		if err != nil {
+			return nil, err
+		}
+		orders = closed.Closed
+	}
+	for txid, o := range orders {
+		return &AddOrderResult{
+			Description: AddOrderDescription{Order: o.Description.Order, Close: o.Description.Close},
+			TxIDs:       []string{txid},
+		}, nil
+	}
+	return nil, nil
+}
+
+type CancelOrderParams struct {
+	// TxID accepts either an order txid or a userref.
+	TxID          string
+	ClientOrderID string
+}
+
+type CancelOrderResult struct {
+	Count   uint32 `json:"count"`
+	Pending bool   `json:"pending"`
+}
+
+func (k *kraken) CancelOrder(ctx context.Context, params *CancelOrderParams) (*CancelOrderResult, error) {
+	if params == nil || (params.TxID == "" && params.ClientOrderID == "") {
+		return nil, fmt.Errorf("error cancelling order: no txid or client order id provided")
+	}
+	body := make(map[string]any)
+	if params.TxID != "" {
+		body["txid"] = params.TxID
+	}
+	if params.ClientOrderID != "" {
+		body["cl_ord_id"] = params.ClientOrderID
+	}
+	g := governorFor(k.apiKey)
+	pair, cost := g.penalty(params.TxID, cancelPenalties)
+	if err := g.waitOrder(ctx, pair, cost); err != nil {
+		return nil, fmt.Errorf("error cancelling order: %w", err)
+	}
+	result, err := requestResult[CancelOrderResult](ctx, k, &requestParams{
+		method:      "POST",
+		path:        "/0/private/CancelOrder",
+		body:        body,
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error cancelling order: %w", err)
+	}
+	g.orderRemoved(params.TxID)
+	return result, nil
+}
+
+type CancelAllResult struct {
+	Count uint32 `json:"count"`
+}
+
+func (k *kraken) CancelAll(ctx context.Context) (*CancelAllResult, error) {
+	g := governorFor(k.apiKey)
+	for pair, cost := range g.cancelAllPenalties() {
+		if err := g.waitOrder(ctx, pair, cost); err != nil {
+			return nil, fmt.Errorf("error cancelling all orders: %w", err)
+		}
+	}
+	result, err := requestResult[CancelAllResult](ctx, k, &requestParams{
+		method:      "POST",
+		path:        "/0/private/CancelAll",
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error cancelling all orders: %w", err)
+	}
+	return result, nil
+}
+
+type EditOrderParams struct {
+	TxID     string
+	Pair     string
+	Volume   string
+	Price    string
+	Price2   string
+	PostOnly bool
+	UserRef  int32
+	DryRun   bool
+}
+
+type EditOrderResult struct {
+	Description     AddOrderDescription `json:"descr"`
+	TxID            string              `json:"txid"`
+	OriginalTxID    string              `json:"originaltxid"`
+	Volume          string              `json:"volume"`
+	Price           string              `json:"price"`
+	Price2          string              `json:"price2"`
+	OrdersCancelled uint32              `json:"orders_cancelled"`
+	Status          string              `json:"status"`
+	ErrorMessage    string              `json:"error_message"`
+}
+
+func (k *kraken) EditOrder(ctx context.Context, params *EditOrderParams) (*EditOrderResult, error) {
+	if params == nil || params.TxID == "" || params.Pair == "" {
+		return nil, fmt.Errorf("error editing order: txid and pair are required")
+	}
+	p, err := k.AssetPair(ctx, params.Pair)
+	if err != nil {
+		return nil, fmt.Errorf("error editing order: %w", err)
+	}
+	body := map[string]any{
+		"txid": params.TxID,
+		"pair": params.Pair,
+	}
+	if params.Volume != "" {
+		volume, err := p.normalizeVolume(params.Volume)
+		if err != nil {
+			return nil, fmt.Errorf("error editing order: %w", err)
+		}
+		body["volume"] = volume
+	}
+	if params.Price != "" {
+		price, err := p.normalizePrice(params.Price)
+		if err != nil {
+			return nil, fmt.Errorf("error editing order: %w", err)
+		}
+		body["price"] = price
+	}
+	if params.Price2 != "" {
+		price2, err := p.normalizePrice(params.Price2)
+		if err != nil {
+			return nil, fmt.Errorf("error editing order: %w", err)
+		}
+		body["price2"] = price2
+	}
+	if params.PostOnly {
+		body["oflags"] = "post"
+	}
+	if params.UserRef != 0 {
+		body["userref"] = params.UserRef
+	}
+	if params.DryRun || k.dryRun {
+		body["validate"] = true
+	}
+	g := governorFor(k.apiKey)
+	_, cost := g.penalty(params.TxID, editPenalties)
+	if err := g.waitOrder(ctx, params.Pair, cost); err != nil {
+		return nil, fmt.Errorf("error editing order: %w", err)
+	}
+	result, err := requestResult[EditOrderResult](ctx, k, &requestParams{
+		method:      "POST",
+		path:        "/0/private/EditOrder",
+		body:        body,
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error editing order: %w", err)
+	}
+	if result.Status == "err" {
+		return result, fmt.Errorf("error editing order: %s", result.ErrorMessage)
+	}
+	if result.TxID != "" {
+		g.orderRemoved(params.TxID)
+		g.orderPlaced(params.Pair, []string{result.TxID})
+	}
+	return result, nil
+}
+
+type AmendOrderParams struct {
+	TxID          string
+	ClientOrderID string
+	OrderQty      string
+	DisplayQty    string
+	LimitPrice    string
+	TriggerPrice  string
+	PostOnly      bool
+}
+
+type AmendOrderResult struct {
+	AmendID string `json:"amend_id"`
+}
+
+func (k *kraken) AmendOrder(ctx context.Context, params *AmendOrderParams) (*AmendOrderResult, error) {
+	if params == nil || (params.TxID == "" && params.ClientOrderID == "") {
+		return nil, fmt.Errorf("error amending order: no txid or client order id provided")
+	}
+	body := make(map[string]any)
+	if params.TxID != "" {
+		body["txid"] = params.TxID
+	}
+	if params.ClientOrderID != "" {
+		body["cl_ord_id"] = params.ClientOrderID
+	}
+	if params.OrderQty != "" {
+		body["order_qty"] = params.OrderQty
+	}
+	if params.DisplayQty != "" {
+		body["display_qty"] = params.DisplayQty
+	}
+	if params.LimitPrice != "" {
+		body["limit_price"] = params.LimitPrice
+	}
+	if params.TriggerPrice != "" {
+		body["trigger_price"] = params.TriggerPrice
+	}
+	if params.PostOnly {
+		body["post_only"] = true
+	}
+	g := governorFor(k.apiKey)
+	pair, cost := g.penalty(params.TxID, amendPenalties)
+	if err := g.waitOrder(ctx, pair, cost); err != nil {
+		return nil, fmt.Errorf("error amending order: %w", err)
+	}
+	result, err := requestResult[AmendOrderResult](ctx, k, &requestParams{
+		method:      "POST",
+		path:        "/0/private/AmendOrder",
+		body:        body,
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error amending order: %w", err)
+	}
+	return result, nil
+}
+
+type BatchOrderResult struct {
+	Description AddOrderDescription `json:"descr"`
+	TxID        string              `json:"txid"`
+	Error       string              `json:"error"`
+}
+
+// AddOrderBatch places up to 15 orders on a single pair in one request. Each
+// order's Pair may be left empty; if set it must match pair. The whole batch
+// is only validated if any of its orders is a dry run.
+func (k *kraken) AddOrderBatch(ctx context.Context, pair string, orders []OrderRequest) (*[]BatchOrderResult, error) {
+	if len(orders) < 2 || len(orders) > 15 {
+		return nil, fmt.Errorf("error adding order batch: batch must contain between 2 and 15 orders")
+	}
+	bodies := make([]map[string]any, 0, len(orders))
+	dryRun := k.dryRun
+	for i := range orders {
+		o := orders[i]
+		if o.Pair == "" {
+			o.Pair = pair
+		} else if o.Pair != pair {
+			return nil, fmt.Errorf("error adding order batch: order %d has pair %s, expected %s", i, o.Pair, pair)
+		}
+		if err := o.validate(); err != nil {
+			return nil, fmt.Errorf("error adding order batch: order %d: %w", i, err)
+		}
+		if err := k.normalizeOrder(ctx, &o); err != nil {
+			return nil, fmt.Errorf("error adding order batch: order %d: %w", i, err)
+		}
+		dryRun = dryRun || o.DryRun
+		b := o.body()
+		delete(b, "pair")
+		delete(b, "validate")
+		bodies = append(bodies, b)
+	}
+	g := governorFor(k.apiKey)
+	if err := g.waitOrder(ctx, pair, float64(len(orders))); err != nil {
+		return nil, fmt.Errorf("error adding order batch: %w", err)
+	}
+	result, err := requestResult[struct {
+		Orders []BatchOrderResult `json:"orders"`
+	}](ctx, k, &requestParams{
+		method: "POST",
+		path:   "/0/private/AddOrderBatch",
+		body: map[string]any{
+			"pair":     pair,
+			"orders":   bodies,
+			"validate": dryRun,
+		},
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error adding order batch: %w", err)
+	}
+	for _, o := range result.Orders {
+		if o.TxID != "" {
+			g.orderPlaced(pair, []string{o.TxID})
+		}
+	}
+	return &result.Orders, nil
+}
+
+type CancelAllOrdersAfterResult struct {
+	CurrentTime string `json:"currentTime"`
+	TriggerTime string `json:"triggerTime"`
+}
+
+// CancelAllOrdersAfter arms Kraken's dead man's switch so that all open orders
+// are cancelled once timeout seconds pass without another call. A timeout of 0
+// disarms it.
+func (k *kraken) CancelAllOrdersAfter(ctx context.Context, timeout uint32) (*CancelAllOrdersAfterResult, error) {
+	result, err := requestResult[CancelAllOrdersAfterResult](ctx, k, &requestParams{
+		method: "POST",
+		path:   "/0/private/CancelAllOrdersAfter",
+		body: map[string]any{
+			"timeout": timeout,
+		},
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error setting cancel all orders after: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,277 @@
+package kraken
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitTier mirrors Kraken's per-verification-level limits. The REST
+// counter covers every private call except order entry, which is limited per
+// pair by the order counter instead. Decay values are per second.
+type RateLimitTier struct {
+	MaxCounter      float64
+	Decay           float64
+	MaxOrderCounter float64
+	OrderDecay      float64
+}
+
+var (
+	TierStarter      = RateLimitTier{MaxCounter: 15, Decay: 0.33, MaxOrderCounter: 60, OrderDecay: 1}
+	TierIntermediate = RateLimitTier{MaxCounter: 20, Decay: 0.5, MaxOrderCounter: 125, OrderDecay: 2.34}
+	TierPro          = RateLimitTier{MaxCounter: 20, Decay: 1, MaxOrderCounter: 180, OrderDecay: 3.75}
+
+	RateLimitTierMap = map[string]RateLimitTier{
+		"starter":      TierStarter,
+		"intermediate": TierIntermediate,
+		"pro":          TierPro,
+	}
+)
+
+const (
+	publicMaxCounter = 3
+	publicDecay      = 1
+	// Orders older than this no longer add a cancel or edit penalty.
+	orderPenaltyWindow = 300 * time.Second
+)
+
+var (
+	restCosts = map[string]float64{
+		"/0/private/Ledgers":              2,
+		"/0/private/QueryLedgers":         2,
+		"/0/private/TradesHistory":        2,
+		"/0/private/QueryTrades":          2,
+		"/0/private/AddOrder":             0,
+		"/0/private/AddOrderBatch":        0,
+		"/0/private/CancelOrder":          0,
+		"/0/private/CancelAll":            0,
+		"/0/private/CancelAllOrdersAfter": 0,
+		"/0/private/EditOrder":            0,
+		"/0/private/AmendOrder":           0,
+	}
+	cancelPenalties = []orderPenalty{
+		{5 * time.Second, 8},
+		{10 * time.Second, 6},
+		{15 * time.Second, 5},
+		{45 * time.Second, 4},
+		{90 * time.Second, 2},
+		{orderPenaltyWindow, 1},
+	}
+	editPenalties = []orderPenalty{
+		{5 * time.Second, 6},
+		{10 * time.Second, 5},
+		{15 * time.Second, 4},
+		{45 * time.Second, 2},
+		{90 * time.Second, 1},
+	}
+	amendPenalties = []orderPenalty{
+		{5 * time.Second, 3},
+		{10 * time.Second, 2},
+		{45 * time.Second, 1},
+	}
+)
+
+var (
+	governors   = make(map[string]*governor)
+	governorsMu sync.Mutex
+)
+
+type orderPenalty struct {
+	age  time.Duration
+	cost float64
+}
+
+type placedOrder struct {
+	pair     string
+	placedAt time.Time
+}
+
+type bucket struct {
+	counter float64
+	updated time.Time
+}
+
+// governor tracks Kraken's decaying counters for a single API key so every
+// client built with that key waits on the same budget.
+type governor struct {
+	tier   RateLimitTier
+	rest   bucket
+	pairs  map[string]*bucket
+	orders map[string]placedOrder
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	sync.Mutex
+}
+
+func newGovernor(tier RateLimitTier) *governor {
+	return &governor{
+		tier:   tier,
+		pairs:  make(map[string]*bucket),
+		orders: make(map[string]placedOrder),
+		now:    time.Now,
+		sleep:  sleep,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func governorFor(apiKey string) *governor {
+	governorsMu.Lock()
+	defer governorsMu.Unlock()
+	g, ok := governors[apiKey]
+	if !ok {
+		tier := TierStarter
+		if apiKey == "" {
+			tier = RateLimitTier{MaxCounter: publicMaxCounter, Decay: publicDecay}
+		}
+		g = newGovernor(tier)
+		governors[apiKey] = g
+	}
+	return g
+}
+
+// SetRateLimitTier sets the limits used for every client sharing apiKey.
+func SetRateLimitTier(apiKey string, tier RateLimitTier) {
+	g := governorFor(apiKey)
+	g.Lock()
+	defer g.Unlock()
+	g.tier = tier
+}
+
+func restCost(path string) float64 {
+	if cost, ok := restCosts[path]; ok {
+		return cost
+	}
+	return 1
+}
+
+// reserve adds cost to b if it fits under max, otherwise it returns how long
+// to wait before trying again. Must be called with the lock held.
+func (g *governor) reserve(b *bucket, max float64, decay float64, cost float64) time.Duration {
+	now := g.now()
+	if !b.updated.IsZero() {
+		b.counter = math.Max(0, b.counter-now.Sub(b.updated).Seconds()*decay)
+	}
+	b.updated = now
+	if b.counter+cost <= max || b.counter == 0 {
+		b.counter += cost
+		return 0
+	}
+	return time.Duration((b.counter + cost - max) / decay * float64(time.Second))
+}
+
+func (g *governor) waitREST(ctx context.Context, cost float64) error {
+	if cost == 0 {
+		return nil
+	}
+	for {
+		g.Lock()
+		wait := g.reserve(&g.rest, g.tier.MaxCounter, g.tier.Decay, cost)
+		g.Unlock()
+		if wait == 0 {
+			return nil
+		}
+		if err := g.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *governor) waitOrder(ctx context.Context, pair string, cost float64) error {
+	if cost == 0 {
+		return nil
+	}
+	for {
+		g.Lock()
+		b, ok := g.pairs[pair]
+		if !ok {
+			b = &bucket{}
+			g.pairs[pair] = b
+		}
+		wait := g.reserve(b, g.tier.MaxOrderCounter, g.tier.OrderDecay, cost)
+		g.Unlock()
+		if wait == 0 {
+			return nil
+		}
+		if err := g.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// rateLimited saturates the REST counter after Kraken reports it was exceeded,
+// so later calls back off until it has decayed.
+func (g *governor) rateLimited() {
+	g.Lock()
+	defer g.Unlock()
+	g.rest.counter = g.tier.MaxCounter
+	g.rest.updated = g.now()
+}
+
+func (g *governor) orderPlaced(pair string, txids []string) {
+	g.Lock()
+	defer g.Unlock()
+	now := g.now()
+	for id, o := range g.orders {
+		if now.Sub(o.placedAt) > orderPenaltyWindow {
+			delete(g.orders, id)
+		}
+	}
+	for _, id := range txids {
+		g.orders[id] = placedOrder{pair: pair, placedAt: now}
+	}
+}
+
+func (g *governor) orderRemoved(txid string) {
+	g.Lock()
+	defer g.Unlock()
+	delete(g.orders, txid)
+}
+
+// penalty returns the pair and counter cost of cancelling or modifying txid
+// based on how long ago it was placed. Unknown orders cost nothing.
+func (g *governor) penalty(txid string, penalties []orderPenalty) (string, float64) {
+	g.Lock()
+	defer g.Unlock()
+	o, ok := g.orders[txid]
+	if !ok {
+		return "", 0
+	}
+	age := g.now().Sub(o.placedAt)
+	for _, p := range penalties {
+		if age < p.age {
+			return o.pair, p.cost
+		}
+	}
+	return o.pair, 0
+}
+
+// cancelAllPenalties sums the cancel penalty of every tracked order per pair
+// and forgets them.
+func (g *governor) cancelAllPenalties() map[string]float64 {
+	g.Lock()
+	defer g.Unlock()
+	costs := make(map[string]float64)
+	now := g.now()
+	for id, o := range g.orders {
+		age := now.Sub(o.placedAt)
+		for _, p := range cancelPenalties {
+			if age < p.age {
+				costs[o.pair] += p.cost
+				break
+			}
+		}
+		delete(g.orders, id)
+	}
+	return costs
+}
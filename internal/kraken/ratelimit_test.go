@@ -0,0 +1,27 @@
+package kraken
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGovernorWaitsForDecay(t *testing.T) {
+	now := time.Unix(0, 0)
+	var slept time.Duration
+	g := newGovernor(RateLimitTier{MaxCounter: 2, Decay: 0.5})
+	g.now = func() time.Time { return now }
+	g.sleep = func(_ context.Context, d time.Duration) error {
+		slept += d
+		now = now.Add(d)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if err := g.waitREST(context.Background(), 1); err != nil {
+			t.Fatalf("failed waiting: %v", err)
+		}
+	}
+	if slept != 2*time.Second {
+		t.Errorf("incorrect wait: %v", slept)
+	}
+}
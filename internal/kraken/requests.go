@@ -1,18 +1,29 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
 )
 
 var (
 	RequestHandlerMap = map[string]RequestHandler{
-		"ohlc": CandleRequest,
+		"ohlc":       CandleRequest,
+		"ticker":     TickerRequestHandler,
+		"trade":      TradeRequestHandler,
+		"book":       BookRequestHandler,
+		"instrument": InstrumentRequestHandler,
+		"status":     StatusRequestHandler,
 	}
 )
 
 type BaseRequest interface {
+	filter() subscriptionFilter
+	// forSymbols returns a copy of the request limited to symbols. Requests
+	// for channels without symbols ignore them.
+	forSymbols(symbols []string) BaseRequest
 	send(wsc *wsClient) error
 	subscribe(wsc *wsClient) error
 	unsubscribe(wsc *wsClient) error
@@ -29,8 +40,51 @@ func CandleRequest(req json.RawMessage) (BaseRequest, error) {
 	return &bReq, nil
 }
 
+func TickerRequestHandler(req json.RawMessage) (BaseRequest, error) {
+	return unmarshalRequest[TickerRequest](req)
+}
+
+func TradeRequestHandler(req json.RawMessage) (BaseRequest, error) {
+	return unmarshalRequest[TradeRequest](req)
+}
+
+func BookRequestHandler(req json.RawMessage) (BaseRequest, error) {
+	return unmarshalRequest[BookRequest](req)
+}
+
+func InstrumentRequestHandler(req json.RawMessage) (BaseRequest, error) {
+	return unmarshalRequest[InstrumentRequest](req)
+}
+
+func StatusRequestHandler(req json.RawMessage) (BaseRequest, error) {
+	return unmarshalRequest[StatusRequest](req)
+}
+
+func unmarshalRequest[T any, PT interface {
+	*T
+	BaseRequest
+}](req json.RawMessage) (BaseRequest, error) {
+	var bReq T
+	if err := json.Unmarshal(req, &bReq); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	return PT(&bReq), nil
+}
+
 type baseRequest struct {
 	Method string `json:"method"`
+	// ReqID is set when the request is sent, to match Kraken's response.
+	ReqID uint64 `json:"req_id,omitempty"`
+}
+
+// sendAndWait writes msg and waits for Kraken to accept it.
+func (b *baseRequest) sendAndWait(wsc *wsClient, msg any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wsCallTimeout)
+	defer cancel()
+	if _, err := wsc.roundTrip(ctx, b, msg); err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	return nil
 }
 
 type CandlesParams struct {
@@ -43,6 +97,16 @@ type CandlesRequest struct {
 	Params CandlesParams `json:"params"`
 }
 
+func (cr *CandlesRequest) filter() subscriptionFilter {
+	return subscriptionFilter{channel: "ohlc", symbols: cr.Params.Symbol, interval: cr.Params.Interval}
+}
+
+func (cr *CandlesRequest) forSymbols(symbols []string) BaseRequest {
+	c := *cr
+	c.Params.Symbol = symbols
+	return &c
+}
+
 func (cr *CandlesRequest) subscribe(wsc *wsClient) error {
 	cr.Method = "subscribe"
 	return cr.send(wsc)
@@ -56,9 +120,350 @@ func (cr *CandlesRequest) unsubscribe(wsc *wsClient) error {
 func (cr *CandlesRequest) send(wsc *wsClient) error {
 	log.Println("Called Candles method")
 	log.Println(cr)
-	err := wsc.conn.WriteJSON(cr)
-	if err != nil {
-		return fmt.Errorf("error sending request: %w", err)
+	if err := cr.sendAndWait(wsc, cr); err != nil {
+		return err
+	}
+	return nil
+}
+
+type TickerParams struct {
+	Channel string   `json:"channel"`
+	Symbol  []string `json:"symbol"`
+	// EventTrigger is "bbo" to get an update on every best bid or offer
+	// change, or "trades" (the default) to get one on every trade.
+	EventTrigger string `json:"event_trigger,omitempty"`
+	Snapshot     *bool  `json:"snapshot,omitempty"`
+}
+
+type TickerRequest struct {
+	baseRequest
+	Params TickerParams `json:"params"`
+}
+
+func (tr *TickerRequest) filter() subscriptionFilter {
+	return subscriptionFilter{channel: "ticker", symbols: tr.Params.Symbol}
+}
+
+func (tr *TickerRequest) forSymbols(symbols []string) BaseRequest {
+	c := *tr
+	c.Params.Symbol = symbols
+	return &c
+}
+
+func (tr *TickerRequest) subscribe(wsc *wsClient) error {
+	tr.Method = "subscribe"
+	return tr.send(wsc)
+}
+
+func (tr *TickerRequest) unsubscribe(wsc *wsClient) error {
+	tr.Method = "unsubscribe"
+	return tr.send(wsc)
+}
+
+func (tr *TickerRequest) send(wsc *wsClient) error {
+	tr.Params.Channel = "ticker"
+	if err := tr.sendAndWait(wsc, tr); err != nil {
+		return err
+	}
+	return nil
+}
+
+type TradeParams struct {
+	Channel  string   `json:"channel"`
+	Symbol   []string `json:"symbol"`
+	Snapshot *bool    `json:"snapshot,omitempty"`
+}
+
+type TradeRequest struct {
+	baseRequest
+	Params TradeParams `json:"params"`
+}
+
+func (tr *TradeRequest) filter() subscriptionFilter {
+	return subscriptionFilter{channel: "trade", symbols: tr.Params.Symbol}
+}
+
+func (tr *TradeRequest) forSymbols(symbols []string) BaseRequest {
+	c := *tr
+	c.Params.Symbol = symbols
+	return &c
+}
+
+func (tr *TradeRequest) subscribe(wsc *wsClient) error {
+	tr.Method = "subscribe"
+	return tr.send(wsc)
+}
+
+func (tr *TradeRequest) unsubscribe(wsc *wsClient) error {
+	tr.Method = "unsubscribe"
+	return tr.send(wsc)
+}
+
+func (tr *TradeRequest) send(wsc *wsClient) error {
+	tr.Params.Channel = "trade"
+	if err := tr.sendAndWait(wsc, tr); err != nil {
+		return err
+	}
+	return nil
+}
+
+// BookDepths are the depths Kraken accepts for the book channel.
+var BookDepths = []uint16{10, 25, 100, 500, 1000}
+
+type BookParams struct {
+	Channel string   `json:"channel"`
+	Symbol  []string `json:"symbol"`
+	// Depth defaults to 10 when left empty.
+	Depth    uint16 `json:"depth,omitempty"`
+	Snapshot *bool  `json:"snapshot,omitempty"`
+}
+
+type BookRequest struct {
+	baseRequest
+	Params BookParams `json:"params"`
+}
+
+func (br *BookRequest) filter() subscriptionFilter {
+	return subscriptionFilter{channel: "book", symbols: br.Params.Symbol}
+}
+
+func (br *BookRequest) forSymbols(symbols []string) BaseRequest {
+	c := *br
+	c.Params.Symbol = symbols
+	return &c
+}
+
+func (br *BookRequest) subscribe(wsc *wsClient) error {
+	br.Method = "subscribe"
+	return br.send(wsc)
+}
+
+func (br *BookRequest) unsubscribe(wsc *wsClient) error {
+	br.Method = "unsubscribe"
+	return br.send(wsc)
+}
+
+func (br *BookRequest) send(wsc *wsClient) error {
+	if br.Params.Depth != 0 && !slices.Contains(BookDepths, br.Params.Depth) {
+		return fmt.Errorf("book depth %d not supported", br.Params.Depth)
+	}
+	br.Params.Channel = "book"
+	if br.Method == "subscribe" {
+		if err := br.trackBooks(wsc); err != nil {
+			return err
+		}
+	}
+	// Books are tracked before the request so the snapshot that follows the ack
+	// is not missed, and dropped again if Kraken refuses the subscription.
+	if err := br.sendAndWait(wsc, br); err != nil {
+		if br.Method == "subscribe" {
+			for _, symbol := range br.Params.Symbol {
+				wsc.books.untrack(symbol)
+			}
+		}
+		return err
+	}
+	if br.Method == "unsubscribe" {
+		for _, symbol := range br.Params.Symbol {
+			wsc.books.untrack(symbol)
+		}
+	}
+	return nil
+}
+
+// sharesWith refuses to join a book held at another depth, as Kraken keeps one
+// book per symbol and the local book has a single depth.
+func (br *BookRequest) sharesWith(held BaseRequest) error {
+	h, ok := held.(*BookRequest)
+	if !ok || bookDepth(h.Params.Depth) == bookDepth(br.Params.Depth) {
+		return nil
+	}
+	return fmt.Errorf("book for %v is already subscribed at depth %d", h.Params.Symbol, bookDepth(h.Params.Depth))
+}
+
+func bookDepth(depth uint16) uint16 {
+	if depth == 0 {
+		return defaultBookDepth
+	}
+	return depth
+}
+
+// trackBooks starts a local book for every symbol, using the pair's precision
+// to verify checksums.
+func (br *BookRequest) trackBooks(wsc *wsClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	for _, symbol := range br.Params.Symbol {
+		p, err := wsc.AssetPair(ctx, symbol)
+		if err != nil {
+			return fmt.Errorf("error getting book precision: %w", err)
+		}
+		wsc.books.track(newLocalBook(symbol, int(br.Params.Depth), p.PairDecimals, p.LotDecimals))
+	}
+	return nil
+}
+
+type InstrumentParams struct {
+	Channel  string `json:"channel"`
+	Snapshot *bool  `json:"snapshot,omitempty"`
+}
+
+// InstrumentRequest subscribes to the reference data of every asset and pair.
+type InstrumentRequest struct {
+	baseRequest
+	Params InstrumentParams `json:"params"`
+}
+
+func (ir *InstrumentRequest) filter() subscriptionFilter {
+	return subscriptionFilter{channel: "instrument"}
+}
+
+func (ir *InstrumentRequest) forSymbols(_ []string) BaseRequest {
+	c := *ir
+	return &c
+}
+
+func (ir *InstrumentRequest) subscribe(wsc *wsClient) error {
+	ir.Method = "subscribe"
+	return ir.send(wsc)
+}
+
+func (ir *InstrumentRequest) unsubscribe(wsc *wsClient) error {
+	ir.Method = "unsubscribe"
+	return ir.send(wsc)
+}
+
+func (ir *InstrumentRequest) send(wsc *wsClient) error {
+	ir.Params.Channel = "instrument"
+	if err := ir.sendAndWait(wsc, ir); err != nil {
+		return err
+	}
+	return nil
+}
+
+type StatusParams struct {
+	Channel string `json:"channel"`
+}
+
+// StatusRequest tracks the exchange's trading status. Kraken publishes it on
+// every connection and whenever it changes without being asked, so nothing is
+// sent and subscribing only registers interest in it.
+type StatusRequest struct {
+	baseRequest
+	Params StatusParams `json:"params"`
+}
+
+func (sr *StatusRequest) filter() subscriptionFilter {
+	return subscriptionFilter{channel: "status"}
+}
+
+func (sr *StatusRequest) forSymbols(_ []string) BaseRequest {
+	c := *sr
+	return &c
+}
+
+func (sr *StatusRequest) subscribe(wsc *wsClient) error {
+	sr.Method = "subscribe"
+	return sr.send(wsc)
+}
+
+func (sr *StatusRequest) unsubscribe(wsc *wsClient) error {
+	sr.Method = "unsubscribe"
+	return sr.send(wsc)
+}
+
+func (sr *StatusRequest) send(_ *wsClient) error {
+	sr.Params.Channel = "status"
+	return nil
+}
+
+type ExecutionsParams struct {
+	Channel     string `json:"channel"`
+	Token       string `json:"token"`
+	SnapTrades  bool   `json:"snap_trades"`
+	SnapOrders  bool   `json:"snap_orders"`
+	OrderStatus bool   `json:"order_status"`
+	RateCounter bool   `json:"ratecounter,omitempty"`
+}
+
+// ExecutionsRequest subscribes to fills and order status changes. It needs a
+// client created with API keys.
+type ExecutionsRequest struct {
+	baseRequest
+	Params ExecutionsParams `json:"params"`
+}
+
+func (er *ExecutionsRequest) filter() subscriptionFilter {
+	return subscriptionFilter{channel: "executions"}
+}
+
+func (er *ExecutionsRequest) forSymbols(_ []string) BaseRequest {
+	c := *er
+	return &c
+}
+
+func (er *ExecutionsRequest) subscribe(wsc *wsClient) error {
+	er.Method = "subscribe"
+	return er.send(wsc)
+}
+
+func (er *ExecutionsRequest) unsubscribe(wsc *wsClient) error {
+	er.Method = "unsubscribe"
+	return er.send(wsc)
+}
+
+func (er *ExecutionsRequest) send(wsc *wsClient) error {
+	if wsc.authToken() == "" {
+		return fmt.Errorf("executions channel requires an authenticated connection")
+	}
+	er.Params.Channel = "executions"
+	er.Params.Token = wsc.authToken()
+	if err := er.sendAndWait(wsc, er); err != nil {
+		return err
+	}
+	return nil
+}
+
+type BalancesParams struct {
+	Channel  string `json:"channel"`
+	Token    string `json:"token"`
+	Snapshot bool   `json:"snapshot"`
+}
+
+// BalancesRequest subscribes to balance snapshots and ledger updates. It needs
+// a client created with API keys.
+type BalancesRequest struct {
+	baseRequest
+	Params BalancesParams `json:"params"`
+}
+
+func (br *BalancesRequest) filter() subscriptionFilter {
+	return subscriptionFilter{channel: "balances"}
+}
+
+func (br *BalancesRequest) forSymbols(_ []string) BaseRequest {
+	c := *br
+	return &c
+}
+
+func (br *BalancesRequest) subscribe(wsc *wsClient) error {
+	br.Method = "subscribe"
+	return br.send(wsc)
+}
+
+func (br *BalancesRequest) unsubscribe(wsc *wsClient) error {
+	br.Method = "unsubscribe"
+	return br.send(wsc)
+}
+
+func (br *BalancesRequest) send(wsc *wsClient) error {
+	if wsc.authToken() == "" {
+		return fmt.Errorf("balances channel requires an authenticated connection")
+	}
+	br.Params.Channel = "balances"
+	br.Params.Token = wsc.authToken()
+	if err := br.sendAndWait(wsc, br); err != nil {
+		return err
 	}
 	return nil
 }
@@ -1,73 +1,56 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"kasegu/external/helpers"
-	"reflect"
 	"strconv"
-	"strings"
 )
 
-func (k *kraken) GetAccountBalance() (*map[string]string, error) {
-	resp, err := request(&requestParams{
+func (k *kraken) GetAccountBalance(ctx context.Context) (*map[string]string, error) {
+	balance, err := requestResult[map[string]string](ctx, k, &requestParams{
 		method:      "POST",
 		path:        "/0/private/Balance",
 		publicKey:   k.apiKey,
 		privateKey:  k.privateKey,
-		environment: BaseURL,
+		environment: k.baseURL,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error getting account balance from endpoint: %w", err)
+		return nil, fmt.Errorf("error getting account balance: %w", err)
 	}
-	defer helpers.CheckedClose(resp.Body)
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading account balance: %w", err)
-	}
-	var balance struct {
-		Error  []string          `json:"error"`
-		Result map[string]string `json:"result"`
-	}
-	if err := json.Unmarshal(data, &balance); err != nil {
-		return nil, fmt.Errorf("error parsing the response: %w", err)
-	}
-	if len(balance.Error) > 0 {
-		return nil, fmt.Errorf("error getting account balance: %s", strings.Join(balance.Error, ","))
-	}
-	return &balance.Result, nil
+	return balance, nil
 }
 
-func (k *kraken) GetOHCLData(pair string, interval uint16) (*map[string]any, error) {
-	resp, err := request(&requestParams{
-		method: "GET",
-		path:   "/0/public/OHLC",
-		query: map[string]any{
-			"pair":     pair,
-			"interval": interval,
-		},
-		environment: BaseURL,
+type OHCLResult struct {
+	Pair string
+	Data []OHCLData
+	// Last is the cursor to pass as since to fetch only newer candles.
+	Last int64
+}
+
+func (k *kraken) GetOHCLData(ctx context.Context, pair string, interval uint16, since int64) (*OHCLResult, error) {
+	query := map[string]any{
+		"pair":     pair,
+		"interval": interval,
+	}
+	if since > 0 {
+		query["since"] = since
+	}
+	result, err := requestResult[map[string]json.RawMessage](ctx, k, &requestParams{
+		method:      "GET",
+		path:        "/0/public/OHLC",
+		query:       query,
+		environment: k.baseURL,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error getting OHCL data from endpoint: %w", err)
+		return nil, fmt.Errorf("error getting OHCL data: %w", err)
 	}
-	defer helpers.CheckedClose(resp.Body)
-	data, err := io.ReadAll(resp.Body)
+	var ohcl OHCLResult
+	ohcl.Pair, err = unmarshalPairResult(*result, &ohcl.Data, &ohcl.Last)
 	if err != nil {
-		return nil, fmt.Errorf("error reading OHCL data: %w", err)
-	}
-	var ohcl struct {
-		Error  []string       `json:"error"`
-		Result map[string]any `json:"result"`
-	}
-	if err := json.Unmarshal(data, &ohcl); err != nil {
 		return nil, fmt.Errorf("error parsing OHCL data: %w", err)
 	}
-	if len(ohcl.Error) > 0 {
-		return nil, fmt.Errorf("error getting : %s", strings.Join(ohcl.Error, ","))
-	}
-	return &ohcl.Result, nil
+	return &ohcl, nil
 }
 
 type OHCLData struct {
@@ -81,82 +64,76 @@ type OHCLData struct {
 	Trades float64
 }
 
-func ParseOHCLData(data *map[string]any) (*[]OHCLData, error) {
-	var keyName string
-	for k := range *data {
-		if k != "last" {
-			keyName = k
+// UnmarshalJSON reads the [time, open, high, low, close, vwap, volume, count]
+// tuple Kraken uses for candles.
+func (o *OHCLData) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 8 {
+		return fmt.Errorf("expected 8 OHCL fields, got %d", len(raw))
+	}
+	fields := []*float64{&o.Time, &o.Open, &o.High, &o.Low, &o.Close, &o.Vwap, &o.Volume, &o.Trades}
+	for i, f := range fields {
+		v, err := parseNumber(raw[i])
+		if err != nil {
+			return fmt.Errorf("OHCL field %d: %w", i, err)
 		}
+		*f = v
 	}
-	dataAny := (*data)[keyName]
-	dataArr, ok := dataAny.([]any)
-	if !ok {
-		return nil, fmt.Errorf("error parsing OHCL data")
-	}
-	ohclData := make([]OHCLData, 0, len(dataArr))
-	for i := range dataArr {
-		r := reflect.ValueOf(dataArr[i])
-		v := make([]float64, r.Len())
-		for i := 0; i < r.Len(); i++ {
-			var f float64
-			var err error
-			var ok bool
-			f, ok = r.Index(i).Elem().Interface().(float64)
-			if !ok {
-				f, err = strconv.ParseFloat(r.Index(i).Elem().Interface().(string), 64)
-				if err != nil {
-					return nil, fmt.Errorf("error parsing OHCL data II: %w", err)
-				}
-			}
-			v[i] = f
-		}
-		ohclData = append(ohclData, OHCLData{
-			Time:   v[0],
-			Open:   v[1],
-			High:   v[2],
-			Low:    v[3],
-			Close:  v[4],
-			Vwap:   v[5],
-			Volume: v[6],
-			Trades: v[7],
-		})
-	}
-	return &ohclData, nil
+	return nil
 }
 
-func (k *kraken) AddOrder(pair string, volume string, transactionType string) error {
-	resp, err := request(&requestParams{
-		method:      "POST",
-		path:        "/0/private/AddOrder",
-		publicKey:   k.apiKey,
-		privateKey:  k.privateKey,
-		environment: BaseURL,
-		body: map[string]any{
-			"ordertype": "market",
-			"type":      transactionType,
-			"pair":      pair,
-			"volume":    volume,
-		},
+// MarshalJSON writes the candle back out as a Kraken tuple so it can be
+// relayed to consumers expecting the REST shape.
+func (o OHCLData) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{
+		int64(o.Time),
+		strconv.FormatFloat(o.Open, 'f', -1, 64),
+		strconv.FormatFloat(o.High, 'f', -1, 64),
+		strconv.FormatFloat(o.Low, 'f', -1, 64),
+		strconv.FormatFloat(o.Close, 'f', -1, 64),
+		strconv.FormatFloat(o.Vwap, 'f', -1, 64),
+		strconv.FormatFloat(o.Volume, 'f', -1, 64),
+		int64(o.Trades),
 	})
-	if err != nil {
-		return fmt.Errorf("error adding order: %w", err)
-	}
-	defer helpers.CheckedClose(resp.Body)
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading transaction: %w", err)
+}
+
+// MergeOHCLData applies an incremental update to existing candles. Candles
+// with a matching time replace the old ones, newer ones are appended and at
+// most limit candles are kept (0 means no limit).
+func MergeOHCLData(existing []OHCLData, update []OHCLData, limit int) []OHCLData {
+	merged := append(make([]OHCLData, 0, len(existing)+len(update)), existing...)
+	for _, u := range update {
+		i := len(merged) - 1
+		for i >= 0 && merged[i].Time > u.Time {
+			i--
+		}
+		if i >= 0 && merged[i].Time == u.Time {
+			merged[i] = u
+		} else if i == len(merged)-1 {
+			merged = append(merged, u)
+		} else {
+			merged = append(merged[:i+1], append([]OHCLData{u}, merged[i+1:]...)...)
+		}
 	}
-	var balance struct {
-		Error  []string        `json:"error"`
-		Result json.RawMessage `json:"result"`
+	if limit > 0 && len(merged) > limit {
+		merged = merged[len(merged)-limit:]
 	}
-	if err := json.Unmarshal(data, &balance); err != nil {
-		return fmt.Errorf("error parsing the response: %w", err)
+	return merged
+}
+
+func parseNumber(raw json.RawMessage) (float64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strconv.ParseFloat(s, 64)
 	}
-	if len(balance.Error) > 0 {
-		return fmt.Errorf("error adding order: %s", strings.Join(balance.Error, ","))
+	var f float64
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return 0, err
 	}
-	return nil
+	return f, nil
 }
 
 type TickerInfo struct {
@@ -171,11 +148,11 @@ type TickerInfo struct {
 	O string   `json:"o"`
 }
 
-func (k *kraken) GetTickerInformation(pair string) (*map[string]TickerInfo, error) {
-	resp, err := request(&requestParams{
+func (k *kraken) GetTickerInformation(ctx context.Context, pair string) (*map[string]TickerInfo, error) {
+	tickerInfo, err := requestResult[map[string]TickerInfo](ctx, k, &requestParams{
 		method:      "GET",
 		path:        "/0/public/Ticker",
-		environment: BaseURL,
+		environment: k.baseURL,
 		query: map[string]any{
 			"pair": pair,
 		},
@@ -183,20 +160,25 @@ func (k *kraken) GetTickerInformation(pair string) (*map[string]TickerInfo, erro
 	if err != nil {
 		return nil, fmt.Errorf("error getting ticker: %w", err)
 	}
-	defer helpers.CheckedClose(resp.Body)
-	data, err := io.ReadAll(resp.Body)
+	return tickerInfo, nil
+}
+
+type WebSocketsToken struct {
+	Token string `json:"token"`
+	// Expires is how many seconds the token can be used to open a connection.
+	Expires uint32 `json:"expires"`
+}
+
+func (k *kraken) GetWebSocketsToken(ctx context.Context) (*WebSocketsToken, error) {
+	token, err := requestResult[WebSocketsToken](ctx, k, &requestParams{
+		method:      "POST",
+		path:        "/0/private/GetWebSocketsToken",
+		publicKey:   k.apiKey,
+		privateKey:  k.privateKey,
+		environment: k.baseURL,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error reading ticker: %w", err)
-	}
-	var tickerInfo struct {
-		Error  []string              `json:"error"`
-		Result map[string]TickerInfo `json:"result"`
-	}
-	if err := json.Unmarshal(data, &tickerInfo); err != nil {
-		return nil, fmt.Errorf("error parsing ticker: %w", err)
-	}
-	if len(tickerInfo.Error) > 0 {
-		return nil, fmt.Errorf("error getting ticker: %s", strings.Join(tickerInfo.Error, ","))
+		return nil, fmt.Errorf("error getting websockets token: %w", err)
 	}
-	return &tickerInfo.Result, nil
+	return token, nil
 }
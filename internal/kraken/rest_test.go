@@ -0,0 +1,36 @@
+package kraken
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOHCLDataRoundTrip(t *testing.T) {
+	raw := `[1688671200,"30306.1","30306.2","30305.7","30305.7","30306.1","3.39243896",23]`
+	var o OHCLData
+	if err := json.Unmarshal([]byte(raw), &o); err != nil {
+		t.Fatalf("failed unmarshalling candle: %v", err)
+	}
+	if o.Time != 1688671200 || o.Close != 30305.7 || o.Trades != 23 {
+		t.Errorf("incorrect candle: %+v", o)
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("failed marshalling candle: %v", err)
+	}
+	if string(b) != raw {
+		t.Errorf("incorrect candle json: %s", b)
+	}
+}
+
+func TestMergeOHCLData(t *testing.T) {
+	existing := []OHCLData{{Time: 1, Close: 1}, {Time: 2, Close: 2}, {Time: 3, Close: 3}}
+	update := []OHCLData{{Time: 3, Close: 30}, {Time: 4, Close: 4}}
+	merged := MergeOHCLData(existing, update, 3)
+	if len(merged) != 3 || merged[0].Time != 2 || merged[1].Close != 30 || merged[2].Time != 4 {
+		t.Errorf("incorrect merge: %+v", merged)
+	}
+	if existing[2].Close != 3 {
+		t.Errorf("merge modified existing candles: %+v", existing)
+	}
+}
@@ -0,0 +1,90 @@
+package kraken
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	mathRand "math/rand/v2"
+	"net/url"
+	"time"
+)
+
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, so 1 disables retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// Order entry isn't idempotent, so these are never retried blindly. AddOrder
+// retries on its own when a client order id lets it detect duplicates.
+var nonIdempotentPaths = map[string]bool{
+	"/0/private/AddOrder":      true,
+	"/0/private/AddOrderBatch": true,
+	"/0/private/EditOrder":     true,
+	"/0/private/AmendOrder":    true,
+}
+
+// isTransient reports whether err is worth retrying: Kraken being busy or
+// unavailable, a rate limit or nonce rejection, or a transport failure.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ErrServiceUnavailable) || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrInvalidNonce) {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// backoff returns a random delay between zero and the exponential backoff
+// for attempt, capped at MaxDelay.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(mathRand.Int64N(int64(d)))
+}
+
+// withRetry runs f until it succeeds, fails with a non-transient error or the
+// policy runs out of attempts. With retry false f runs exactly once.
+func (k *kraken) withRetry(ctx context.Context, retry bool, f func() error) error {
+	attempts := k.retryPolicy.MaxAttempts
+	if !retry || attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if sErr := sleep(ctx, k.retryPolicy.backoff(attempt-1)); sErr != nil {
+				return err
+			}
+		}
+		err = f()
+		if err == nil || !isTransient(ctx, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// NewClientOrderID returns a random UUID to use as an order's ClientOrderID.
+func NewClientOrderID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,83 @@
+package kraken
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			_, _ = w.Write([]byte(`{"error":["EService:Unavailable"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"error":[],"result":{"ZUSD":"100.0"}}`))
+	}))
+	defer srv.Close()
+	k, err := NewClient("retry-test", "a2V5",
+		WithBaseURL(srv.URL),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	if _, err := k.GetAccountBalance(context.Background()); err != nil {
+		t.Fatalf("failed getting balance: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("incorrect number of calls: %d", calls)
+	}
+}
+
+func TestAddOrderRetryFindsClientOrder(t *testing.T) {
+	var addOrders, lookups int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/AssetPairs":
+			_, _ = w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","wsname":"XBT/USD","pair_decimals":1,"lot_decimals":8,"status":"online"}}}`))
+		case "/0/private/AddOrder":
+			// The order reaches the book but the response is lost.
+			addOrders++
+			w.WriteHeader(http.StatusBadGateway)
+		case "/0/private/OpenOrders":
+			lookups++
+			_, _ = w.Write([]byte(`{"error":[],"result":{"open":{}}}`))
+		case "/0/private/ClosedOrders":
+			lookups++
+			_, _ = w.Write([]byte(`{"error":[],"result":{"closed":{"OTX-1":{"status":"closed","descr":{"order":"buy 1.00000000 XBTUSD @ market"}}},"count":1}}`))
+		}
+	}))
+	defer srv.Close()
+	k, err := NewClient("add-order-retry-test", "a2V5",
+		WithBaseURL(srv.URL),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	order := &OrderRequest{Pair: "XBTUSD", Side: SideBuy, OrderType: OrderTypeMarket, Volume: "1", ClientOrderID: "retry-1"}
+	res, err := k.AddOrder(context.Background(), order)
+	if err != nil {
+		t.Fatalf("failed adding order: %v", err)
+	}
+	if addOrders != 1 {
+		t.Errorf("expected one AddOrder call, got %d", addOrders)
+	}
+	if len(res.TxIDs) != 1 || res.TxIDs[0] != "OTX-1" {
+		t.Errorf("expected the found order's txid, got %v", res.TxIDs)
+	}
+
+	addOrders, lookups = 0, 0
+	order.ClientOrderID = ""
+	if _, err := k.AddOrder(context.Background(), order); err == nil {
+		t.Errorf("expected the failed order without a client order id to fail")
+	}
+	if addOrders != 1 || lookups != 0 {
+		t.Errorf("expected no retry without a client order id, got %d AddOrder calls and %d lookups", addOrders, lookups)
+	}
+}
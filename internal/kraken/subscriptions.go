@@ -0,0 +1,241 @@
+package kraken
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+)
+
+// wsStreamBuffer is how many events a subscription's stream holds before new
+// ones are dropped.
+const wsStreamBuffer = 256
+
+// subscriptionFilter selects the events belonging to a subscription. Without
+// symbols every event on the channel matches.
+type subscriptionFilter struct {
+	channel  string
+	symbols  []string
+	interval uint16
+}
+
+// apply returns the part of e that belongs to the subscription, and false if
+// none does. Connection state changes belong to every subscription.
+func (f subscriptionFilter) apply(e *Event) (Event, bool) {
+	if e.Channel == ConnectionChannel {
+		return *e, true
+	}
+	if e.Channel != f.channel {
+		return Event{}, false
+	}
+	if len(f.symbols) == 0 {
+		return *e, true
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(e.Data, &entries); err != nil {
+		return *e, true
+	}
+	matched := make([]json.RawMessage, 0, len(entries))
+	for _, entry := range entries {
+		var id struct {
+			Symbol   string `json:"symbol"`
+			Interval uint16 `json:"interval"`
+		}
+		if err := json.Unmarshal(entry, &id); err != nil {
+			continue
+		}
+		if slices.Contains(f.symbols, id.Symbol) && (f.interval == 0 || id.Interval == f.interval) {
+			matched = append(matched, entry)
+		}
+	}
+	if len(matched) == 0 {
+		return Event{}, false
+	}
+	filtered := *e
+	if len(matched) < len(entries) {
+		data, err := json.Marshal(matched)
+		if err != nil {
+			log.Printf("kraken websocket filter error: %v", err)
+			return Event{}, false
+		}
+		filtered.Data = data
+	}
+	return filtered, true
+}
+
+// upstream identifies a subscription on Kraken's side. Kraken keeps one per
+// channel, symbol and interval, however many keys share it.
+type upstream struct {
+	channel  string
+	symbol   string
+	interval uint16
+}
+
+func (f subscriptionFilter) upstreams() []upstream {
+	if len(f.symbols) == 0 {
+		return []upstream{{channel: f.channel, interval: f.interval}}
+	}
+	ups := make([]upstream, len(f.symbols))
+	for i, symbol := range f.symbols {
+		ups[i] = upstream{channel: f.channel, symbol: symbol, interval: f.interval}
+	}
+	return ups
+}
+
+type subscription struct {
+	filter subscriptionFilter
+	events chan Event
+}
+
+// upstreamSubscription is an upstream and the number of keys holding it. br
+// subscribes to it alone, to be replayed on reconnect and sent as an
+// unsubscribe when the last key is released.
+type upstreamSubscription struct {
+	br   BaseRequest
+	refs int
+}
+
+// subscriptionRegistry holds a websocket client's subscriptions by key, counts
+// the keys sharing each upstream and hands every event to the streams it
+// belongs to.
+type subscriptionRegistry struct {
+	subs      map[string]*subscription
+	upstreams map[upstream]*upstreamSubscription
+	closed    bool
+	sync.RWMutex
+}
+
+func newSubscriptionRegistry() *subscriptionRegistry {
+	return &subscriptionRegistry{
+		subs:      make(map[string]*subscription),
+		upstreams: make(map[upstream]*upstreamSubscription),
+	}
+}
+
+func (r *subscriptionRegistry) has(key string) bool {
+	r.RLock()
+	defer r.RUnlock()
+	_, ok := r.subs[key]
+	return ok
+}
+
+// missing returns the upstreams no key holds yet.
+func (r *subscriptionRegistry) missing(ups []upstream) []upstream {
+	r.RLock()
+	defer r.RUnlock()
+	var missing []upstream
+	for _, u := range ups {
+		if _, ok := r.upstreams[u]; !ok {
+			missing = append(missing, u)
+		}
+	}
+	return missing
+}
+
+// upstream returns the request an upstream was subscribed with.
+func (r *subscriptionRegistry) upstream(u upstream) (BaseRequest, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	us, ok := r.upstreams[u]
+	if !ok {
+		return nil, false
+	}
+	return us.br, true
+}
+
+// add registers key with a stream of the events matching filter. subscribed
+// holds the requests of the upstreams that were just subscribed to, while the
+// filter's other upstreams must already be held.
+func (r *subscriptionRegistry) add(key string, filter subscriptionFilter, subscribed map[upstream]BaseRequest) (<-chan Event, error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return nil, fmt.Errorf("websocket client is closed")
+	}
+	for u, br := range subscribed {
+		r.upstreams[u] = &upstreamSubscription{br: br}
+	}
+	for _, u := range filter.upstreams() {
+		r.upstreams[u].refs++
+	}
+	s := &subscription{
+		filter: filter,
+		events: make(chan Event, wsStreamBuffer),
+	}
+	r.subs[key] = s
+	return s.events, nil
+}
+
+// remove deletes the subscription and closes its stream. It returns the
+// requests of the upstreams no key holds anymore, which should be
+// unsubscribed from.
+func (r *subscriptionRegistry) remove(key string) []BaseRequest {
+	r.Lock()
+	defer r.Unlock()
+	s, ok := r.subs[key]
+	if !ok {
+		return nil
+	}
+	close(s.events)
+	delete(r.subs, key)
+	var released []BaseRequest
+	for _, u := range s.filter.upstreams() {
+		us, ok := r.upstreams[u]
+		if !ok {
+			continue
+		}
+		if us.refs--; us.refs <= 0 {
+			released = append(released, us.br)
+			delete(r.upstreams, u)
+		}
+	}
+	return released
+}
+
+// closeAll closes every stream and refuses new subscriptions.
+func (r *subscriptionRegistry) closeAll() {
+	r.Lock()
+	defer r.Unlock()
+	for key, s := range r.subs {
+		close(s.events)
+		delete(r.subs, key)
+	}
+	clear(r.upstreams)
+	r.closed = true
+}
+
+// requests returns the request of every upstream held.
+func (r *subscriptionRegistry) requests() map[upstream]BaseRequest {
+	r.RLock()
+	defer r.RUnlock()
+	requests := make(map[upstream]BaseRequest, len(r.upstreams))
+	for u, us := range r.upstreams {
+		requests[u] = us.br
+	}
+	return requests
+}
+
+func (r *subscriptionRegistry) len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.subs)
+}
+
+// dispatch sends e to every subscription it belongs to without blocking the
+// read loop, dropping it for streams that are full.
+func (r *subscriptionRegistry) dispatch(e *Event) {
+	r.RLock()
+	defer r.RUnlock()
+	for key, s := range r.subs {
+		filtered, ok := s.filter.apply(e)
+		if !ok {
+			continue
+		}
+		select {
+		case s.events <- filtered:
+		default:
+			log.Printf("kraken websocket stream %s is full, dropping %s event", key, e.Channel)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package kraken
+
+import (
+	"testing"
+)
+
+func TestSubscriptionRegistryDispatch(t *testing.T) {
+	r := newSubscriptionRegistry()
+	btc, err := addRequest(r, "btc", &CandlesRequest{Params: CandlesParams{Symbol: []string{"BTC/USD"}, Interval: 5}})
+	if err != nil {
+		t.Fatalf("failed adding subscription: %v", err)
+	}
+	eth, _ := addRequest(r, "eth", &CandlesRequest{Params: CandlesParams{Symbol: []string{"ETH/USD"}, Interval: 5}})
+	r.dispatch(&Event{
+		Channel: "ohlc",
+		Type:    "update",
+		Data:    []byte(`[{"symbol":"BTC/USD","interval":5,"close":1},{"symbol":"ETH/USD","interval":5,"close":2}]`),
+	})
+	r.dispatch(&Event{Channel: "ticker", Data: []byte(`[{"symbol":"BTC/USD"}]`)})
+	r.dispatch(&Event{Channel: ConnectionChannel, Type: ConnectionReconnecting})
+	ev := <-btc
+	if candles, err := ev.Candles(); err != nil || len(candles) != 1 || candles[0].Symbol != "BTC/USD" {
+		t.Errorf("incorrect btc event: %+v %v", candles, err)
+	}
+	ev = <-eth
+	if candles, err := ev.Candles(); err != nil || len(candles) != 1 || candles[0].Symbol != "ETH/USD" {
+		t.Errorf("incorrect eth event: %+v %v", candles, err)
+	}
+	if ev = <-btc; ev.Channel != ConnectionChannel {
+		t.Errorf("expected connection state, got %s", ev.Channel)
+	}
+	if released := r.remove("btc"); len(released) != 1 {
+		t.Errorf("expected btc's upstream to be released, got %v", released)
+	}
+	if _, ok := <-btc; ok {
+		t.Errorf("stream not closed on removal")
+	}
+	r.closeAll()
+	if _, err := addRequest(r, "btc", &CandlesRequest{}); err == nil {
+		t.Errorf("expected adding to a closed registry to fail")
+	}
+}
+
+func TestSubscriptionRegistryUpstreams(t *testing.T) {
+	r := newSubscriptionRegistry()
+	req := &TradeRequest{Params: TradeParams{Symbol: []string{"BTC/USD"}}}
+	if _, err := addRequest(r, "bot", req); err != nil {
+		t.Fatalf("failed adding subscription: %v", err)
+	}
+	if missing := r.missing(req.filter().upstreams()); len(missing) != 0 {
+		t.Errorf("held upstream reported missing: %v", missing)
+	}
+	relay, _ := addRequest(r, "relay", &TradeRequest{Params: TradeParams{Symbol: []string{"BTC/USD", "ETH/USD"}}})
+	if released := r.remove("bot"); len(released) != 0 {
+		t.Errorf("upstream released while relay still holds it: %v", released)
+	}
+	r.dispatch(&Event{Channel: "trade", Data: []byte(`[{"symbol":"BTC/USD"}]`)})
+	if ev := <-relay; ev.Channel != "trade" {
+		t.Errorf("expected relay to still get trades, got %+v", ev)
+	}
+	if released := r.remove("relay"); len(released) != 2 {
+		t.Errorf("expected both upstreams released, got %v", released)
+	}
+}
+
+// addRequest adds br like wsClient.Subscribe does, as if every upstream it
+// needs were just subscribed to.
+func addRequest(r *subscriptionRegistry, key string, br BaseRequest) (<-chan Event, error) {
+	filter := br.filter()
+	subscribed := make(map[upstream]BaseRequest)
+	for _, u := range r.missing(filter.upstreams()) {
+		subscribed[u] = br.forSymbols([]string{u.symbol})
+	}
+	return r.add(key, filter, subscribed)
+}
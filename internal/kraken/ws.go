@@ -1,30 +1,79 @@
 package kraken
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"kasegu/external/helpers"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 const (
-	PublicWSURL = "wss://ws.kraken.com/v2"
+	PublicWSURL  = "wss://ws.kraken.com/v2"
+	PrivateWSURL = "wss://ws-auth.kraken.com/v2"
+
+	wsCallTimeout      = 10 * time.Second
+	wsPingInterval     = 5 * time.Second
+	wsHeartbeatTimeout = 15 * time.Second
+)
+
+// Events on ConnectionChannel report the state of the connection to Kraken,
+// with the state as Type.
+const (
+	ConnectionChannel      = "connection"
+	ConnectionReconnecting = "reconnecting"
+	ConnectionConnected    = "connected"
 )
 
+// ErrConnectionLost is returned by calls whose connection dropped before
+// Kraken answered, and by writes made while reconnecting.
+var ErrConnectionLost = errors.New("kraken websocket connection lost")
+
+var wsReconnectPolicy = RetryPolicy{
+	BaseDelay: time.Second,
+	MaxDelay:  time.Minute,
+}
+
 type WsClient interface {
-	Subscribe(channel string, br BaseRequest) error
-	Unsubscribe(channel string) error
+	Subscribe(key string, br BaseRequest) (<-chan Event, error)
+	Unsubscribe(key string) error
 	Close() error
 	AreThereActiveSubscriptions() bool
-	BindResponse() *chan Event
+	// Book returns the local book kept for symbol while the book channel is
+	// subscribed for it.
+	Book(symbol string) (*LocalBook, error)
+	// Order entry needs a client created with API keys. Each call blocks
+	// until Kraken acknowledges it or wsCallTimeout passes.
+	AddOrder(ctx context.Context, order *OrderRequest) (*WsOrderResult, error)
+	AmendOrder(ctx context.Context, params *AmendOrderParams) (*WsAmendOrderResult, error)
+	CancelOrder(ctx context.Context, params *CancelOrderParams) (*WsOrderResult, error)
+	CancelAll(ctx context.Context) (*CancelAllResult, error)
+	BatchAdd(ctx context.Context, pair string, orders []OrderRequest) (*[]WsOrderResult, error)
 }
 
 type wsClient struct {
-	conn     *websocket.Conn
-	res      chan Event
-	handlers map[string]BaseRequest
+	conn *websocket.Conn
+	subs *subscriptionRegistry
+	// subscribeMu serializes Subscribe and Unsubscribe.
+	subscribeMu sync.Mutex
+	// token, like conn, is replaced on reconnect under writeMu.
+	token string
+	// lost is closed when conn drops, failing the calls still waiting on it.
+	// It is replaced with conn.
+	lost      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closed    atomic.Bool
+	reqID     atomic.Uint64
+	pending   map[uint64]chan MethodResponse
+	pendingMu sync.Mutex
+	writeMu   sync.Mutex
+	books     *bookEngine
 	kraken
 }
 
@@ -32,11 +81,64 @@ type Event struct {
 	Channel   string          `json:"channel"`
 	Data      json.RawMessage `json:"data,omitempty"`
 	Type      string          `json:"type,omitempty"`
-	Timestamp string          `json:"timestamp,omisustempty"`
+	Timestamp string          `json:"timestamp,omitempty"`
+}
+
+type ExecutionFee struct {
+	Asset string  `json:"asset"`
+	Qty   float64 `json:"qty"`
+}
+
+type Execution struct {
+	ExecType     string         `json:"exec_type"`
+	OrderID      string         `json:"order_id"`
+	ClOrdID      string         `json:"cl_ord_id"`
+	OrderUserRef int32          `json:"order_userref"`
+	Symbol       string         `json:"symbol"`
+	Side         string         `json:"side"`
+	OrderType    string         `json:"order_type"`
+	OrderQty     float64        `json:"order_qty"`
+	LimitPrice   float64        `json:"limit_price"`
+	OrderStatus  string         `json:"order_status"`
+	CumQty       float64        `json:"cum_qty"`
+	CumCost      float64        `json:"cum_cost"`
+	AvgPrice     float64        `json:"avg_price"`
+	ExecID       string         `json:"exec_id"`
+	TradeID      int64          `json:"trade_id"`
+	LastQty      float64        `json:"last_qty"`
+	LastPrice    float64        `json:"last_price"`
+	Cost         float64        `json:"cost"`
+	Fees         []ExecutionFee `json:"fees"`
+	LiquidityInd string         `json:"liquidity_ind"`
+	Timestamp    string         `json:"timestamp"`
+}
+
+type Wallet struct {
+	Type    string  `json:"type"`
+	ID      string  `json:"id"`
+	Balance float64 `json:"balance"`
+}
+
+// Balance is an entry of the balances channel. Snapshots fill Wallets, while
+// updates describe the ledger entry that changed the balance.
+type Balance struct {
+	Asset      string   `json:"asset"`
+	AssetClass string   `json:"asset_class"`
+	Balance    float64  `json:"balance"`
+	Wallets    []Wallet `json:"wallets,omitempty"`
+	LedgerID   string   `json:"ledger_id,omitempty"`
+	RefID      string   `json:"ref_id,omitempty"`
+	Timestamp  string   `json:"timestamp,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Subtype    string   `json:"subtype,omitempty"`
+	Amount     float64  `json:"amount,omitempty"`
+	Fee        float64  `json:"fee,omitempty"`
+	WalletType string   `json:"wallet_type,omitempty"`
+	WalletID   string   `json:"wallet_id,omitempty"`
 }
 
-func openConnection(endpoint string) (*websocket.Conn, error) {
-	c, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+func openConnection(ctx context.Context, endpoint string) (*websocket.Conn, error) {
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to establish websocket connection to endpoint %s: %w", endpoint, err)
 	}
@@ -44,10 +146,39 @@ func openConnection(endpoint string) (*websocket.Conn, error) {
 }
 
 func (wsc *wsClient) readMessages() {
-	wsc.res = make(chan Event)
-	defer close(wsc.res)
-	defer helpers.CheckedClose(wsc)
+	defer wsc.subs.closeAll()
 	for {
+		wsc.readConnection()
+		wsc.writeMu.Lock()
+		close(wsc.lost)
+		wsc.writeMu.Unlock()
+		if wsc.closed.Load() {
+			return
+		}
+		wsc.emitState(ConnectionReconnecting)
+		if err := wsc.reconnect(); err != nil {
+			log.Printf("kraken websocket gave up reconnecting: %v", err)
+			return
+		}
+		wsc.emitState(ConnectionConnected)
+	}
+}
+
+// readConnection relays messages from the current connection until it fails,
+// is closed or goes quiet for longer than wsHeartbeatTimeout.
+func (wsc *wsClient) readConnection() {
+	defer func() {
+		if err := wsc.conn.Close(); err != nil {
+			log.Printf("kraken websocket close error: %v", err)
+		}
+	}()
+	for {
+		if !wsc.closed.Load() {
+			if err := wsc.conn.SetReadDeadline(time.Now().Add(wsHeartbeatTimeout)); err != nil {
+				log.Printf("kraken websocket deadline error: %v", err)
+				return
+			}
+		}
 		_, msg, err := wsc.conn.ReadMessage()
 		if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 			log.Println("kraken websocket closed via abnormal closure")
@@ -56,62 +187,344 @@ func (wsc *wsClient) readMessages() {
 			log.Printf("kraken websocket read error: %v", err)
 			return
 		}
+		if wsc.resolve(msg) {
+			continue
+		}
 		var request Event
 		if err := json.Unmarshal(msg, &request); err != nil {
 			log.Printf("kraken websocket unmarshal error: %v", err)
 			continue
 		}
-		wsc.res <- request
+		if request.Channel == "heartbeat" {
+			continue
+		}
+		if request.Channel == "book" {
+			stale, err := wsc.books.handle(&request)
+			if err != nil {
+				log.Printf("kraken websocket book error: %v", err)
+			}
+			for _, symbol := range stale {
+				wsc.resyncBook(symbol)
+			}
+		}
+		wsc.subs.dispatch(&request)
+	}
+}
+
+// reconnect dials Kraken with backoff until it succeeds or the client is
+// closed, then replays every subscription.
+func (wsc *wsClient) reconnect() error {
+	for attempt := 0; ; attempt++ {
+		if err := sleep(wsc.ctx, wsReconnectPolicy.backoff(attempt)); err != nil {
+			return err
+		}
+		conn, token, err := wsc.dial(wsc.ctx)
+		if err != nil {
+			log.Printf("kraken websocket reconnect attempt %d failed: %v", attempt+1, err)
+			continue
+		}
+		wsc.writeMu.Lock()
+		wsc.conn = conn
+		wsc.token = token
+		wsc.lost = make(chan struct{})
+		wsc.writeMu.Unlock()
+		// Resubscribing waits for acknowledgements, which only this
+		// goroutine can read.
+		go wsc.resubscribe()
+		return nil
 	}
 }
 
-func NewWebSocketClient(apiKeyEnv string, privateKeyEnv string) (WsClient, error) {
-	connection, err := openConnection(PublicWSURL)
+func (wsc *wsClient) resubscribe() {
+	for u, br := range wsc.subs.requests() {
+		if err := br.subscribe(wsc); err != nil {
+			log.Printf("kraken websocket failed resubscribing to %s %s: %v", u.channel, u.symbol, err)
+		}
+	}
+}
+
+// dial opens a connection to the public endpoint, or to the authenticated
+// one with a fresh token when the client has API keys.
+func (wsc *wsClient) dial(ctx context.Context) (*websocket.Conn, string, error) {
+	endpoint := wsc.wsURL
+	var token string
+	if wsc.apiKey != "" && wsc.privateKey != "" {
+		t, err := wsc.GetWebSocketsToken(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get websocket token: %w", err)
+		}
+		endpoint = wsc.wsAuthURL
+		token = t.Token
+	}
+	conn, err := openConnection(ctx, endpoint)
 	if err != nil {
-		return nil, fmt.Errorf("failed to establish websocket connection: %w", err)
+		return nil, "", err
+	}
+	return conn, token, nil
+}
+
+// keepAlive pings Kraken so a connection without subscriptions still gets
+// messages and a silent one is noticed by the read deadline. Nothing is sent
+// while reconnecting.
+func (wsc *wsClient) keepAlive() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := wsc.writeJSON(map[string]string{"method": "ping"})
+			if err != nil && !errors.Is(err, ErrConnectionLost) {
+				log.Printf("kraken websocket ping error: %v", err)
+			}
+		case <-wsc.ctx.Done():
+			return
+		}
 	}
-	kClient, err := newClient(apiKeyEnv, privateKeyEnv)
+}
+
+func (wsc *wsClient) emitState(state string) {
+	wsc.subs.dispatch(&Event{
+		Channel: ConnectionChannel,
+		Type:    state,
+	})
+}
+
+func NewWebSocketClient(ctx context.Context, apiKeyEnv string, privateKeyEnv string, opts ...Option) (WsClient, error) {
+	kClient, err := newClient(apiKeyEnv, privateKeyEnv, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to establish kraken client: %w", err)
 	}
 	wsC := wsClient{
-		conn:     connection,
-		kraken:   *kClient,
-		handlers: make(map[string]BaseRequest),
+		kraken:  *kClient,
+		subs:    newSubscriptionRegistry(),
+		pending: make(map[uint64]chan MethodResponse),
+		books:   newBookEngine(),
+		lost:    make(chan struct{}),
 	}
+	wsC.conn, wsC.token, err = wsC.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish websocket connection: %w", err)
+	}
+	wsC.ctx, wsC.cancel = context.WithCancel(context.Background())
 	go wsC.readMessages()
+	go wsC.keepAlive()
 	return &wsC, nil
 }
 
-func (wsc *wsClient) Close() error {
-	return helpers.CloseWebsocket(wsc.conn)
+// MethodResponse is Kraken's acknowledgement of a request sent with a req_id.
+type MethodResponse struct {
+	Method  string          `json:"method"`
+	ReqID   uint64          `json:"req_id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Success bool            `json:"success"`
+	Error   string          `json:"error,omitempty"`
+	TimeIn  string          `json:"time_in"`
+	TimeOut string          `json:"time_out"`
 }
 
-func (wsc *wsClient) Subscribe(channel string, br BaseRequest) error {
-	_, ok := wsc.handlers[channel]
+func (wsc *wsClient) writeJSON(v any) error {
+	_, err := wsc.send(v)
+	return err
+}
+
+// send writes v to the current connection and returns the channel closed when
+// that connection drops.
+func (wsc *wsClient) send(v any) (<-chan struct{}, error) {
+	wsc.writeMu.Lock()
+	defer wsc.writeMu.Unlock()
+	select {
+	case <-wsc.lost:
+		return nil, ErrConnectionLost
+	default:
+	}
+	return wsc.lost, wsc.conn.WriteJSON(v)
+}
+
+// resolve consumes msg if it is a response to a request, handing it to the
+// call waiting on its req_id, and reports whether it did. Responses nobody
+// waits for, like pongs, are only logged when they failed.
+func (wsc *wsClient) resolve(msg []byte) bool {
+	var resp MethodResponse
+	if err := json.Unmarshal(msg, &resp); err != nil || resp.Method == "" {
+		return false
+	}
+	wsc.pendingMu.Lock()
+	ch, ok := wsc.pending[resp.ReqID]
+	delete(wsc.pending, resp.ReqID)
+	wsc.pendingMu.Unlock()
 	if ok {
-		var err = wsc.Unsubscribe(channel)
-		if err != nil {
+		ch <- resp
+	} else if !resp.Success && resp.Method != "pong" {
+		log.Printf("kraken websocket %s failed: %s", resp.Method, resp.Error)
+	}
+	return true
+}
+
+// call sends method with params and blocks until Kraken acknowledges it, ctx
+// is done or wsCallTimeout passes. Unsuccessful acknowledgements are returned
+// as errors.
+func (wsc *wsClient) call(ctx context.Context, method string, params any) (*MethodResponse, error) {
+	req := struct {
+		baseRequest
+		Params any `json:"params,omitempty"`
+	}{baseRequest{Method: method}, params}
+	return wsc.roundTrip(ctx, &req.baseRequest, &req)
+}
+
+// roundTrip sends msg, whose embedded base is given so its req_id can be set,
+// and waits for the matching response like call.
+func (wsc *wsClient) roundTrip(ctx context.Context, base *baseRequest, msg any) (*MethodResponse, error) {
+	method := base.Method
+	id := wsc.reqID.Add(1)
+	base.ReqID = id
+	ch := make(chan MethodResponse, 1)
+	wsc.pendingMu.Lock()
+	wsc.pending[id] = ch
+	wsc.pendingMu.Unlock()
+	defer func() {
+		wsc.pendingMu.Lock()
+		delete(wsc.pending, id)
+		wsc.pendingMu.Unlock()
+	}()
+	lost, err := wsc.send(msg)
+	if err != nil {
+		return nil, fmt.Errorf("error sending %s: %w", method, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, wsCallTimeout)
+	defer cancel()
+	select {
+	case resp := <-ch:
+		if !resp.Success {
+			return &resp, fmt.Errorf("%s failed: %w", method, parseErrors([]string{resp.Error}))
+		}
+		return &resp, nil
+	case <-lost:
+		return nil, fmt.Errorf("%s: %w", method, ErrConnectionLost)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+func (wsc *wsClient) authToken() string {
+	wsc.writeMu.Lock()
+	defer wsc.writeMu.Unlock()
+	return wsc.token
+}
+
+// Close stops reconnecting and asks Kraken to close the connection. The read
+// loop closes it once Kraken answers or the read deadline passes.
+func (wsc *wsClient) Close() error {
+	if wsc.closed.Swap(true) {
+		return nil
+	}
+	wsc.cancel()
+	wsc.writeMu.Lock()
+	defer wsc.writeMu.Unlock()
+	err := wsc.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second),
+	)
+	if err != nil {
+		return fmt.Errorf("failed closing websocket: %w", err)
+	}
+	return wsc.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+}
+
+// Subscribe makes the subscription br and registers it under key, replacing
+// any subscription already there. It returns a stream of the subscription's
+// events and connection state changes, closed on Unsubscribe or Close.
+//
+// Keys share Kraken's subscriptions: only the symbols no other key holds are
+// subscribed to, so a key joining a held one gets no snapshot. If Kraken
+// refuses any of the symbols, the others are unsubscribed from again and
+// nothing is registered.
+func (wsc *wsClient) Subscribe(key string, br BaseRequest) (<-chan Event, error) {
+	wsc.subscribeMu.Lock()
+	defer wsc.subscribeMu.Unlock()
+	if wsc.subs.has(key) {
+		if err := wsc.unsubscribe(key); err != nil {
 			log.Printf("kraken websocket unsubscribe error: %v", err)
 		}
 	}
-	if err := br.subscribe(wsc); err != nil {
-		return fmt.Errorf("kraken websocket subscription error: %w", err)
+	filter := br.filter()
+	if err := wsc.checkShared(br, filter); err != nil {
+		return nil, fmt.Errorf("kraken websocket subscription error: %w", err)
 	}
-	wsc.handlers[channel] = br
-	return nil
+	missing := wsc.subs.missing(filter.upstreams())
+	subscribed := make(map[upstream]BaseRequest, len(missing))
+	var errs []error
+	// Kraken acknowledges every symbol of a request on its own under the same
+	// req_id, so each upstream is subscribed to with its own request.
+	for _, u := range missing {
+		var symbol []string
+		if u.symbol != "" {
+			symbol = []string{u.symbol}
+		}
+		ur := br.forSymbols(symbol)
+		if err := ur.subscribe(wsc); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		subscribed[u] = ur
+	}
+	if err := errors.Join(errs...); err != nil {
+		for _, ur := range subscribed {
+			if err := ur.unsubscribe(wsc); err != nil {
+				log.Printf("kraken websocket unsubscribe error: %v", err)
+			}
+		}
+		return nil, fmt.Errorf("kraken websocket subscription error: %w", err)
+	}
+	events, err := wsc.subs.add(key, filter, subscribed)
+	if err != nil {
+		return nil, fmt.Errorf("kraken websocket subscription error: %w", err)
+	}
+	return events, nil
+}
+
+func (wsc *wsClient) Unsubscribe(key string) error {
+	wsc.subscribeMu.Lock()
+	defer wsc.subscribeMu.Unlock()
+	return wsc.unsubscribe(key)
 }
 
-func (wsc *wsClient) Unsubscribe(channel string) error {
-	br, ok := wsc.handlers[channel]
+// sharedRequest is implemented by requests with options Kraken allows only
+// one of per upstream, so they can't join one held with other options.
+type sharedRequest interface {
+	sharesWith(held BaseRequest) error
+}
+
+func (wsc *wsClient) checkShared(br BaseRequest, filter subscriptionFilter) error {
+	sr, ok := br.(sharedRequest)
 	if !ok {
-		return fmt.Errorf("kraken websocket subscription error: channel %s not found", channel)
+		return nil
 	}
-	err := br.unsubscribe(wsc)
-	if err != nil {
+	for _, u := range filter.upstreams() {
+		if held, ok := wsc.subs.upstream(u); ok {
+			if err := sr.sharesWith(held); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unsubscribe closes key's stream and unsubscribes from what no other key
+// still holds.
+func (wsc *wsClient) unsubscribe(key string) error {
+	if !wsc.subs.has(key) {
+		return fmt.Errorf("kraken websocket subscription error: %s not found", key)
+	}
+	var errs []error
+	for _, br := range wsc.subs.remove(key) {
+		if err := br.unsubscribe(wsc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
 		return fmt.Errorf("kraken websocket unsubscription error: %w", err)
 	}
-	delete(wsc.handlers, channel)
 	return nil
 }
 
@@ -130,12 +543,40 @@ func GetMethodAndChannelFromByteArray(req []byte) (string, string, error) {
 	return bRequest.Method, bRequest.Param.Channel, nil
 }
 
-func (wsc *wsClient) AreThereActiveSubscriptions() bool {
-	return len(wsc.handlers) > 0
+func (wsc *wsClient) Book(symbol string) (*LocalBook, error) {
+	book, ok := wsc.books.get(symbol)
+	if !ok {
+		return nil, fmt.Errorf("no book subscribed for %s", symbol)
+	}
+	return book, nil
 }
 
-func (wsc *wsClient) BindResponse() *chan Event {
-	return &wsc.res
+// resyncBook resubscribes to symbol's book so Kraken sends a fresh snapshot
+// after a checksum mismatch.
+func (wsc *wsClient) resyncBook(symbol string) {
+	book, ok := wsc.books.get(symbol)
+	if !ok {
+		return
+	}
+	log.Printf("kraken book checksum mismatch for %s, resyncing", symbol)
+	for _, method := range []string{"unsubscribe", "subscribe"} {
+		req := BookRequest{
+			baseRequest: baseRequest{Method: method},
+			Params: BookParams{
+				Channel: "book",
+				Symbol:  []string{symbol},
+				Depth:   uint16(book.depth),
+			},
+		}
+		if err := wsc.writeJSON(&req); err != nil {
+			log.Printf("kraken book resync error: %v", err)
+			return
+		}
+	}
+}
+
+func (wsc *wsClient) AreThereActiveSubscriptions() bool {
+	return wsc.subs.len() > 0
 }
 
 /*
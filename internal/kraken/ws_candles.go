@@ -0,0 +1,190 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// liveCandles is how many candles a CandleFeed keeps.
+const liveCandles = 720
+
+// candleFeedID tells apart the keys of feeds for the same symbol and interval.
+var candleFeedID atomic.Uint64
+
+// CandleFeed builds live candles of any interval from the trade channel,
+// backfilled over REST. Its events look like the ohlc channel's, so consumers
+// can't tell them from Kraken's own candles. Feeds for the same symbol share
+// the client's one trade subscription.
+type CandleFeed struct {
+	symbol  string
+	key     string
+	builder *CandleBuilder
+	k       Kraken
+	wsc     WsClient
+	events  chan Event
+}
+
+func NewCandleFeed(ctx context.Context, k Kraken, wsc WsClient, symbol string, interval time.Duration) (*CandleFeed, error) {
+	b, err := NewCandleBuilder(interval, liveCandles)
+	if err != nil {
+		return nil, fmt.Errorf("error creating candle feed: %w", err)
+	}
+	key := fmt.Sprintf("candles:%s:%s:%d", symbol, interval, candleFeedID.Add(1))
+	// Subscribe before backfilling so no trade falls in between. Trades
+	// already backfilled are skipped by their id.
+	trades, err := wsc.Subscribe(key, &TradeRequest{Params: TradeParams{Symbol: []string{symbol}}})
+	if err != nil {
+		return nil, fmt.Errorf("error creating candle feed: %w", err)
+	}
+	if err := backfillFeed(ctx, k, b, symbol); err != nil {
+		if uErr := wsc.Unsubscribe(key); uErr != nil {
+			log.Printf("candle feed unsubscribe error: %v", uErr)
+		}
+		return nil, fmt.Errorf("error backfilling candle feed: %w", err)
+	}
+	f := &CandleFeed{
+		symbol:  symbol,
+		key:     key,
+		builder: b,
+		k:       k,
+		wsc:     wsc,
+		events:  make(chan Event, wsStreamBuffer),
+	}
+	go f.run(trades)
+	return f, nil
+}
+
+// Events streams candle updates and connection state changes until Close.
+func (f *CandleFeed) Events() <-chan Event {
+	return f.events
+}
+
+func (f *CandleFeed) Candles() []OHCLData {
+	return f.builder.Candles()
+}
+
+func (f *CandleFeed) Close() error {
+	return f.wsc.Unsubscribe(f.key)
+}
+
+func (f *CandleFeed) run(trades <-chan Event) {
+	defer close(f.events)
+	reconnecting := false
+	for ev := range trades {
+		if ev.Channel == ConnectionChannel {
+			f.emit(ev)
+			if ev.Type == ConnectionReconnecting {
+				reconnecting = true
+			} else if ev.Type == ConnectionConnected && reconnecting {
+				reconnecting = false
+				f.backfillGap()
+			}
+			continue
+		}
+		data, err := ev.Trades()
+		if err != nil {
+			log.Printf("candle feed error: %v", err)
+			continue
+		}
+		var candles []Candle
+		for _, t := range data {
+			ts, err := time.Parse(time.RFC3339Nano, t.Timestamp)
+			if err != nil {
+				log.Printf("candle feed error: %v", err)
+				continue
+			}
+			c, ok := f.builder.AddTrade(t.Price, t.Qty, ts, t.TradeID)
+			if !ok {
+				continue
+			}
+			candle := f.candle(c)
+			if n := len(candles); n > 0 && candles[n-1].IntervalBegin == candle.IntervalBegin {
+				candles[n-1] = candle
+			} else {
+				candles = append(candles, candle)
+			}
+		}
+		f.emitCandles(candles, ev.Timestamp)
+	}
+}
+
+// backfillFeed fills b with the closed candles resampled from Kraken's and
+// rebuilds the current one from trades, so the live trades that follow are
+// counted once. Without a Kraken interval to resample, every candle is
+// rebuilt from trades.
+func backfillFeed(ctx context.Context, k Kraken, b *CandleBuilder, symbol string) error {
+	current := b.start(clockOf(k)().Unix())
+	from := current - backfillCandles*int64(b.interval/time.Second)
+	if baseInterval(b.interval) > 0 {
+		if _, _, err := resampleCandles(ctx, k, b, symbol, from, current); err != nil {
+			return err
+		}
+		from = current
+	}
+	return backfillTrades(ctx, k, b, symbol, from)
+}
+
+// backfillGap adds the trades missed while reconnecting, resuming from the
+// last trade seen, and emits the candles they changed.
+func (f *CandleFeed) backfillGap() {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	since := f.builder.lastTrade()
+	if err := backfillTrades(ctx, f.k, f.builder, f.symbol, since); err != nil {
+		log.Printf("candle feed %s backfill error: %v", f.key, err)
+		return
+	}
+	var candles []Candle
+	for _, c := range f.builder.Candles() {
+		if int64(c.Time) >= f.builder.start(since) {
+			candles = append(candles, f.candle(c))
+		}
+	}
+	f.emitCandles(candles, clockOf(f.k)().UTC().Format(time.RFC3339Nano))
+}
+
+func (f *CandleFeed) emitCandles(candles []Candle, timestamp string) {
+	if len(candles) == 0 {
+		return
+	}
+	raw, err := json.Marshal(candles)
+	if err != nil {
+		log.Printf("candle feed error: %v", err)
+		return
+	}
+	f.emit(Event{
+		Channel:   "ohlc",
+		Type:      "update",
+		Timestamp: timestamp,
+		Data:      raw,
+	})
+}
+
+func (f *CandleFeed) emit(ev Event) {
+	select {
+	case f.events <- ev:
+	default:
+		log.Printf("candle feed %s is full, dropping %s event", f.key, ev.Channel)
+	}
+}
+
+func (f *CandleFeed) candle(c OHCLData) Candle {
+	interval := f.builder.Interval()
+	return Candle{
+		Symbol:        f.symbol,
+		Open:          c.Open,
+		High:          c.High,
+		Low:           c.Low,
+		Close:         c.Close,
+		Vwap:          c.Vwap,
+		Trades:        int64(c.Trades),
+		Volume:        c.Volume,
+		IntervalBegin: time.Unix(int64(c.Time), 0).UTC().Format(time.RFC3339Nano),
+		Interval:      uint16(interval / time.Minute),
+		Timestamp:     clockOf(f.k)().UTC().Format(time.RFC3339Nano),
+	}
+}
@@ -0,0 +1,66 @@
+package kraken
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCandleFeedsShareTrades(t *testing.T) {
+	policy := wsReconnectPolicy
+	wsReconnectPolicy = RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	defer func() { wsReconnectPolicy = policy }()
+	tradesSince := make(chan string, 8)
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/OHLC":
+			_, _ = w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":[],"last":0}}`))
+		case "/0/public/Trades":
+			tradesSince <- r.URL.Query().Get("since")
+			_, _ = w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":[["100.0","1.0",1700000000.5,"b","m","",7]],"last":"1700000000500000000"}}`))
+		}
+	})
+	fake, client := newFakeKrakenWs(t, rest)
+	defer client.Close()
+	k := &client.(*wsClient).kraken
+	first, err := NewCandleFeed(context.Background(), k, client, "BTC/USD", 7*time.Minute)
+	if err != nil {
+		t.Fatalf("failed creating feed: %v", err)
+	}
+	second, err := NewCandleFeed(context.Background(), k, client, "BTC/USD", 7*time.Minute)
+	if err != nil {
+		t.Fatalf("second feed on the same symbol failed: %v", err)
+	}
+	receive(t, tradesSince, "first backfill")
+	receive(t, tradesSince, "second backfill")
+	if req := receive(t, fake.requests, "subscribe"); req != (fakeRequest{"subscribe", 1}) {
+		t.Errorf("expected one trade subscription, got %+v", req)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("failed closing feed: %v", err)
+	}
+	if _, err := client.(*wsClient).call(context.Background(), "hang", nil); err == nil {
+		t.Fatalf("expected the connection to drop")
+	}
+	for ev := range second.Events() {
+		if ev.Channel == ConnectionChannel && ev.Type == ConnectionConnected {
+			break
+		}
+	}
+	if since := receive(t, tradesSince, "gap backfill"); since != "1700000000" {
+		t.Errorf("expected the gap backfilled from the last trade, got since %s", since)
+	}
+	if ev := receive(t, second.Events(), "backfilled candle"); ev.Channel != "ohlc" {
+		t.Errorf("expected a candle update, got %+v", ev)
+	}
+	if req := receive(t, fake.requests, "resubscribe"); req != (fakeRequest{"subscribe", 2}) {
+		t.Errorf("expected the shared trade subscription replayed, got %+v", req)
+	}
+	if err := second.Close(); err != nil {
+		t.Fatalf("failed closing feed: %v", err)
+	}
+	if req := receive(t, fake.requests, "unsubscribe"); req != (fakeRequest{"unsubscribe", 2}) {
+		t.Errorf("expected unsubscribe once both feeds closed, got %+v", req)
+	}
+}
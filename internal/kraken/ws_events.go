@@ -0,0 +1,91 @@
+package kraken
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Candle struct {
+	Symbol        string  `json:"symbol"`
+	Open          float64 `json:"open"`
+	High          float64 `json:"high"`
+	Low           float64 `json:"low"`
+	Close         float64 `json:"close"`
+	Vwap          float64 `json:"vwap"`
+	Trades        int64   `json:"trades"`
+	Volume        float64 `json:"volume"`
+	IntervalBegin string  `json:"interval_begin"`
+	Interval      uint16  `json:"interval"`
+	Timestamp     string  `json:"timestamp"`
+}
+
+type Ticker struct {
+	Symbol    string  `json:"symbol"`
+	Bid       float64 `json:"bid"`
+	BidQty    float64 `json:"bid_qty"`
+	Ask       float64 `json:"ask"`
+	AskQty    float64 `json:"ask_qty"`
+	Last      float64 `json:"last"`
+	Volume    float64 `json:"volume"`
+	Vwap      float64 `json:"vwap"`
+	Low       float64 `json:"low"`
+	High      float64 `json:"high"`
+	Change    float64 `json:"change"`
+	ChangePct float64 `json:"change_pct"`
+}
+
+type WsTrade struct {
+	Symbol    string  `json:"symbol"`
+	Side      string  `json:"side"`
+	Price     float64 `json:"price"`
+	Qty       float64 `json:"qty"`
+	OrderType string  `json:"ord_type"`
+	TradeID   int64   `json:"trade_id"`
+	Timestamp string  `json:"timestamp"`
+}
+
+// BookUpdate is an entry of the book channel. On snapshots Bids and Asks hold
+// the whole book, on updates only the levels that changed, where a quantity of
+// zero removes the level.
+type BookUpdate struct {
+	Symbol    string      `json:"symbol"`
+	Bids      []BookLevel `json:"bids"`
+	Asks      []BookLevel `json:"asks"`
+	Checksum  uint32      `json:"checksum"`
+	Timestamp string      `json:"timestamp"`
+}
+
+func (e *Event) Candles() ([]Candle, error) {
+	return decodeEventData[Candle](e, "ohlc")
+}
+
+func (e *Event) Tickers() ([]Ticker, error) {
+	return decodeEventData[Ticker](e, "ticker")
+}
+
+func (e *Event) Trades() ([]WsTrade, error) {
+	return decodeEventData[WsTrade](e, "trade")
+}
+
+func (e *Event) BookUpdates() ([]BookUpdate, error) {
+	return decodeEventData[BookUpdate](e, "book")
+}
+
+func (e *Event) Executions() ([]Execution, error) {
+	return decodeEventData[Execution](e, "executions")
+}
+
+func (e *Event) Balances() ([]Balance, error) {
+	return decodeEventData[Balance](e, "balances")
+}
+
+func decodeEventData[T any](e *Event, channel string) ([]T, error) {
+	if e.Channel != channel {
+		return nil, fmt.Errorf("event is from channel %s, not %s", e.Channel, channel)
+	}
+	var data []T
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", channel, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,26 @@
+package kraken
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEventCandles(t *testing.T) {
+	var e Event
+	msg := `{"channel":"ohlc","type":"update","timestamp":"2024-01-01T00:00:00.000Z","data":[{"symbol":"BTC/USD",` +
+		`"open":42000.1,"high":42100,"low":41900.5,"close":42050,"vwap":42010.2,"trades":12,"volume":1.5,` +
+		`"interval_begin":"2024-01-01T00:00:00.000000000Z","interval":5,"timestamp":"2024-01-01T00:04:59.000000Z"}]}`
+	if err := json.Unmarshal([]byte(msg), &e); err != nil {
+		t.Fatalf("failed decoding event: %v", err)
+	}
+	candles, err := e.Candles()
+	if err != nil {
+		t.Fatalf("failed decoding candles: %v", err)
+	}
+	if len(candles) != 1 || candles[0].Close != 42050 || candles[0].Interval != 5 || candles[0].Trades != 12 {
+		t.Errorf("incorrect candles: %+v", candles)
+	}
+	if _, err := e.Tickers(); err == nil {
+		t.Errorf("expected decoding candles as tickers to fail")
+	}
+}
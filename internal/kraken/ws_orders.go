@@ -0,0 +1,356 @@
+package kraken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type WsOrderResult struct {
+	OrderID       string   `json:"order_id"`
+	ClientOrderID string   `json:"cl_ord_id"`
+	UserRef       int32    `json:"order_userref"`
+	Warnings      []string `json:"warnings"`
+}
+
+type WsAmendOrderResult struct {
+	AmendID       string `json:"amend_id"`
+	OrderID       string `json:"order_id"`
+	ClientOrderID string `json:"cl_ord_id"`
+}
+
+// wsParams converts the order to the params of an add_order request. The
+// websocket API wants numbers instead of strings, lowercase time in force,
+// RFC 3339 times and the pair's wsname as symbol.
+func (o *OrderRequest) wsParams(symbol string, now time.Time) (map[string]any, error) {
+	qty, err := wsNumber(o.Volume)
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume: %w", err)
+	}
+	params := map[string]any{
+		"order_type": o.OrderType,
+		"side":       o.Side,
+		"order_qty":  qty,
+		"symbol":     symbol,
+	}
+	limitPrice, triggerPrice := o.Price, ""
+	switch o.OrderType {
+	case OrderTypeStopLoss, OrderTypeTakeProfit, OrderTypeTrailingStop:
+		limitPrice, triggerPrice = "", o.Price
+	case OrderTypeStopLossLimit, OrderTypeTakeProfitLimit:
+		limitPrice, triggerPrice = o.Price2, o.Price
+	}
+	if limitPrice != "" {
+		price, err := wsNumber(limitPrice)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price: %w", err)
+		}
+		params["limit_price"] = price
+	}
+	if triggerPrice != "" {
+		triggers, err := wsTriggers(triggerPrice, o.Trigger)
+		if err != nil {
+			return nil, err
+		}
+		params["triggers"] = triggers
+	}
+	if o.TimeInForce != "" {
+		params["time_in_force"] = strings.ToLower(o.TimeInForce)
+	}
+	if o.PostOnly {
+		params["post_only"] = true
+	}
+	if o.ReduceOnly {
+		params["reduce_only"] = true
+	}
+	if o.StartTime != "" {
+		t, err := wsTime(o.StartTime, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start time: %w", err)
+		}
+		params["effective_time"] = t
+	}
+	if o.ExpireTime != "" {
+		t, err := wsTime(o.ExpireTime, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expire time: %w", err)
+		}
+		params["expire_time"] = t
+	}
+	if o.UserRef != 0 {
+		params["order_userref"] = o.UserRef
+	}
+	if o.ClientOrderID != "" {
+		params["cl_ord_id"] = o.ClientOrderID
+	}
+	return params, nil
+}
+
+// wsTriggers translates a REST trigger price, which may be an offset such as
+// "+50" or "-2%", into the websocket triggers object.
+func wsTriggers(price string, reference string) (map[string]any, error) {
+	priceType := "static"
+	switch {
+	case strings.HasSuffix(price, "%"):
+		priceType = "pct"
+	case strings.HasPrefix(price, "+") || strings.HasPrefix(price, "-"):
+		priceType = "quote"
+	}
+	v, err := wsNumber(strings.TrimSuffix(strings.TrimPrefix(price, "+"), "%"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid trigger price: %w", err)
+	}
+	triggers := map[string]any{
+		"price":      v,
+		"price_type": priceType,
+	}
+	if reference != "" {
+		triggers["reference"] = reference
+	}
+	return triggers, nil
+}
+
+func wsNumber(s string) (json.Number, error) {
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return "", err
+	}
+	return json.Number(s), nil
+}
+
+// wsTime converts the REST time formats, a unix timestamp or "+<seconds>"
+// from now, to RFC 3339.
+func wsTime(s string, now time.Time) (string, error) {
+	if offset, ok := strings.CutPrefix(s, "+"); ok {
+		seconds, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		return now.Add(time.Duration(seconds) * time.Second).UTC().Format(time.RFC3339), nil
+	}
+	unix, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339), nil
+}
+
+func (wsc *wsClient) requireToken() error {
+	if wsc.authToken() == "" {
+		return fmt.Errorf("order entry requires an authenticated websocket client")
+	}
+	return nil
+}
+
+// prepareOrder validates and normalizes order like the REST AddOrder does and
+// returns the pair's metadata.
+func (wsc *wsClient) prepareOrder(ctx context.Context, order *OrderRequest) (*AssetPair, error) {
+	if err := order.validate(); err != nil {
+		return nil, err
+	}
+	if err := wsc.normalizeOrder(ctx, order); err != nil {
+		return nil, err
+	}
+	return wsc.AssetPair(ctx, order.Pair)
+}
+
+func (wsc *wsClient) AddOrder(ctx context.Context, order *OrderRequest) (*WsOrderResult, error) {
+	if order == nil {
+		return nil, fmt.Errorf("error adding order: no order provided")
+	}
+	if err := wsc.requireToken(); err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	normalized := *order
+	p, err := wsc.prepareOrder(ctx, &normalized)
+	if err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	params, err := normalized.wsParams(p.WsName, wsc.now())
+	if err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	params["token"] = wsc.authToken()
+	if normalized.DryRun || wsc.dryRun {
+		params["validate"] = true
+	}
+	g := governorFor(wsc.apiKey)
+	if err := g.waitOrder(ctx, normalized.Pair, 1); err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	resp, err := wsc.call(ctx, "add_order", params)
+	if err != nil {
+		return nil, fmt.Errorf("error adding order: %w", err)
+	}
+	var result WsOrderResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, fmt.Errorf("error parsing add order result: %w", err)
+	}
+	if result.OrderID != "" {
+		g.orderPlaced(normalized.Pair, []string{result.OrderID})
+	}
+	return &result, nil
+}
+
+func (wsc *wsClient) AmendOrder(ctx context.Context, params *AmendOrderParams) (*WsAmendOrderResult, error) {
+	if params == nil || (params.TxID == "" && params.ClientOrderID == "") {
+		return nil, fmt.Errorf("error amending order: no txid or client order id provided")
+	}
+	if err := wsc.requireToken(); err != nil {
+		return nil, fmt.Errorf("error amending order: %w", err)
+	}
+	body := map[string]any{
+		"token": wsc.authToken(),
+	}
+	if params.TxID != "" {
+		body["order_id"] = params.TxID
+	}
+	if params.ClientOrderID != "" {
+		body["cl_ord_id"] = params.ClientOrderID
+	}
+	for key, value := range map[string]string{
+		"order_qty":     params.OrderQty,
+		"display_qty":   params.DisplayQty,
+		"limit_price":   params.LimitPrice,
+		"trigger_price": params.TriggerPrice,
+	} {
+		if value == "" {
+			continue
+		}
+		v, err := wsNumber(value)
+		if err != nil {
+			return nil, fmt.Errorf("error amending order: invalid %s: %w", key, err)
+		}
+		body[key] = v
+	}
+	if params.PostOnly {
+		body["post_only"] = true
+	}
+	g := governorFor(wsc.apiKey)
+	pair, cost := g.penalty(params.TxID, amendPenalties)
+	if err := g.waitOrder(ctx, pair, cost); err != nil {
+		return nil, fmt.Errorf("error amending order: %w", err)
+	}
+	resp, err := wsc.call(ctx, "amend_order", body)
+	if err != nil {
+		return nil, fmt.Errorf("error amending order: %w", err)
+	}
+	var result WsAmendOrderResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, fmt.Errorf("error parsing amend order result: %w", err)
+	}
+	return &result, nil
+}
+
+func (wsc *wsClient) CancelOrder(ctx context.Context, params *CancelOrderParams) (*WsOrderResult, error) {
+	if params == nil || (params.TxID == "" && params.ClientOrderID == "") {
+		return nil, fmt.Errorf("error cancelling order: no txid or client order id provided")
+	}
+	if err := wsc.requireToken(); err != nil {
+		return nil, fmt.Errorf("error cancelling order: %w", err)
+	}
+	body := map[string]any{
+		"token": wsc.authToken(),
+	}
+	if params.TxID != "" {
+		body["order_id"] = []string{params.TxID}
+	}
+	if params.ClientOrderID != "" {
+		body["cl_ord_id"] = []string{params.ClientOrderID}
+	}
+	g := governorFor(wsc.apiKey)
+	pair, cost := g.penalty(params.TxID, cancelPenalties)
+	if err := g.waitOrder(ctx, pair, cost); err != nil {
+		return nil, fmt.Errorf("error cancelling order: %w", err)
+	}
+	resp, err := wsc.call(ctx, "cancel_order", body)
+	if err != nil {
+		return nil, fmt.Errorf("error cancelling order: %w", err)
+	}
+	var result WsOrderResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, fmt.Errorf("error parsing cancel order result: %w", err)
+	}
+	g.orderRemoved(params.TxID)
+	return &result, nil
+}
+
+func (wsc *wsClient) CancelAll(ctx context.Context) (*CancelAllResult, error) {
+	if err := wsc.requireToken(); err != nil {
+		return nil, fmt.Errorf("error cancelling all orders: %w", err)
+	}
+	g := governorFor(wsc.apiKey)
+	for pair, cost := range g.cancelAllPenalties() {
+		if err := g.waitOrder(ctx, pair, cost); err != nil {
+			return nil, fmt.Errorf("error cancelling all orders: %w", err)
+		}
+	}
+	resp, err := wsc.call(ctx, "cancel_all", map[string]any{"token": wsc.authToken()})
+	if err != nil {
+		return nil, fmt.Errorf("error cancelling all orders: %w", err)
+	}
+	var result CancelAllResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, fmt.Errorf("error parsing cancel all result: %w", err)
+	}
+	return &result, nil
+}
+
+// BatchAdd places between 2 and 15 orders on a single pair in one request,
+// with the same rules as AddOrderBatch.
+func (wsc *wsClient) BatchAdd(ctx context.Context, pair string, orders []OrderRequest) (*[]WsOrderResult, error) {
+	if len(orders) < 2 || len(orders) > 15 {
+		return nil, fmt.Errorf("error adding order batch: batch must contain between 2 and 15 orders")
+	}
+	if err := wsc.requireToken(); err != nil {
+		return nil, fmt.Errorf("error adding order batch: %w", err)
+	}
+	params := make([]map[string]any, 0, len(orders))
+	dryRun := wsc.dryRun
+	var symbol string
+	for i := range orders {
+		o := orders[i]
+		if o.Pair == "" {
+			o.Pair = pair
+		} else if o.Pair != pair {
+			return nil, fmt.Errorf("error adding order batch: order %d has pair %s, expected %s", i, o.Pair, pair)
+		}
+		p, err := wsc.prepareOrder(ctx, &o)
+		if err != nil {
+			return nil, fmt.Errorf("error adding order batch: order %d: %w", i, err)
+		}
+		symbol = p.WsName
+		dryRun = dryRun || o.DryRun
+		b, err := o.wsParams(symbol, wsc.now())
+		if err != nil {
+			return nil, fmt.Errorf("error adding order batch: order %d: %w", i, err)
+		}
+		delete(b, "symbol")
+		params = append(params, b)
+	}
+	g := governorFor(wsc.apiKey)
+	if err := g.waitOrder(ctx, pair, float64(len(orders))); err != nil {
+		return nil, fmt.Errorf("error adding order batch: %w", err)
+	}
+	resp, err := wsc.call(ctx, "batch_add", map[string]any{
+		"symbol":   symbol,
+		"orders":   params,
+		"validate": dryRun,
+		"token":    wsc.authToken(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error adding order batch: %w", err)
+	}
+	var result []WsOrderResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return nil, fmt.Errorf("error parsing order batch result: %w", err)
+	}
+	for _, o := range result {
+		if o.OrderID != "" {
+			g.orderPlaced(pair, []string{o.OrderID})
+		}
+	}
+	return &result, nil
+}
@@ -0,0 +1,36 @@
+package kraken
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestOrderWsParams(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	o := OrderRequest{
+		Pair:        "XBTUSD",
+		Side:        SideSell,
+		OrderType:   OrderTypeStopLossLimit,
+		Volume:      "0.5",
+		Price:       "-2%",
+		Price2:      "41000.1",
+		Trigger:     "index",
+		TimeInForce: TimeInForceGTD,
+		ExpireTime:  "+60",
+		UserRef:     7,
+	}
+	params, err := o.wsParams("BTC/USD", now)
+	if err != nil {
+		t.Fatalf("failed converting order: %v", err)
+	}
+	got, _ := json.Marshal(params)
+	want := `{"expire_time":"2023-11-14T22:14:20Z","limit_price":41000.1,"order_qty":0.5,"order_type":"stop-loss-limit","order_userref":7,"side":"sell","symbol":"BTC/USD","time_in_force":"gtd","triggers":{"price":-2,"price_type":"pct","reference":"index"}}`
+	if string(got) != want {
+		t.Errorf("incorrect params:\n got %s\nwant %s", got, want)
+	}
+	o.Volume = "abc"
+	if _, err := o.wsParams("BTC/USD", now); err == nil {
+		t.Errorf("expected invalid volume to fail")
+	}
+}
@@ -0,0 +1,215 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeKrakenWs acknowledges subscribe and unsubscribe requests one symbol at a
+// time like Kraken, refusing "BAD/USD", reports them with the connection they
+// arrived on, and drops the connection when asked to "hang".
+type fakeKrakenWs struct {
+	conns    atomic.Int32
+	requests chan fakeRequest
+	upgrader websocket.Upgrader
+	// rest serves the requests that aren't websocket upgrades.
+	rest http.Handler
+}
+
+type fakeRequest struct {
+	method string
+	conn   int32
+}
+
+func (f *fakeKrakenWs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.rest != nil && !websocket.IsWebSocketUpgrade(r) {
+		f.rest.ServeHTTP(w, r)
+		return
+	}
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	n := f.conns.Add(1)
+	for {
+		var req struct {
+			Method string `json:"method"`
+			ReqID  uint64 `json:"req_id"`
+			Params struct {
+				Symbol []string `json:"symbol"`
+			} `json:"params"`
+		}
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		switch req.Method {
+		case "subscribe", "unsubscribe":
+			f.requests <- fakeRequest{method: req.Method, conn: n}
+			symbols := req.Params.Symbol
+			if len(symbols) == 0 {
+				symbols = []string{""}
+			}
+			for _, symbol := range symbols {
+				resp := MethodResponse{Method: req.Method, ReqID: req.ReqID, Success: symbol != "BAD/USD"}
+				if !resp.Success {
+					resp.Error = "Currency pair not supported " + symbol
+				}
+				_ = conn.WriteJSON(resp)
+			}
+		case "hang":
+			return
+		}
+	}
+}
+
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	var zero T
+	return zero
+}
+
+func TestWsClientReconnect(t *testing.T) {
+	policy := wsReconnectPolicy
+	wsReconnectPolicy = RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	defer func() { wsReconnectPolicy = policy }()
+	fake, client := newFakeKrakenWs(t, nil)
+	defer client.Close()
+	events, err := client.Subscribe("trades", &TradeRequest{Params: TradeParams{Symbol: []string{"BTC/USD"}}})
+	if err != nil {
+		t.Fatalf("failed subscribing: %v", err)
+	}
+	if req := receive(t, fake.requests, "subscribe"); req != (fakeRequest{"subscribe", 1}) {
+		t.Errorf("expected subscribe on connection 1, got %+v", req)
+	}
+	start := time.Now()
+	_, err = client.(*wsClient).call(context.Background(), "hang", nil)
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Errorf("expected connection lost error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= wsCallTimeout {
+		t.Errorf("call failed after %s instead of when the connection dropped", elapsed)
+	}
+	if ev := receive(t, events, "reconnecting state"); ev.Channel != ConnectionChannel || ev.Type != ConnectionReconnecting {
+		t.Errorf("expected reconnecting state, got %+v", ev)
+	}
+	if ev := receive(t, events, "connected state"); ev.Channel != ConnectionChannel || ev.Type != ConnectionConnected {
+		t.Errorf("expected connected state, got %+v", ev)
+	}
+	if req := receive(t, fake.requests, "resubscribe"); req != (fakeRequest{"subscribe", 2}) {
+		t.Errorf("expected resubscribe on connection 2, got %+v", req)
+	}
+}
+
+func TestWsClientSharedSubscription(t *testing.T) {
+	fake, client := newFakeKrakenWs(t, nil)
+	defer client.Close()
+	btc := &TradeRequest{Params: TradeParams{Symbol: []string{"BTC/USD"}}}
+	if _, err := client.Subscribe("bot", btc); err != nil {
+		t.Fatalf("failed subscribing: %v", err)
+	}
+	relay, err := client.Subscribe("relay", &TradeRequest{Params: TradeParams{Symbol: []string{"BTC/USD"}}})
+	if err != nil {
+		t.Fatalf("second key on the same symbol failed: %v", err)
+	}
+	if err := client.Unsubscribe("bot"); err != nil {
+		t.Fatalf("failed unsubscribing: %v", err)
+	}
+	select {
+	case _, ok := <-relay:
+		if !ok {
+			t.Errorf("relay stream closed by the bot unsubscribing")
+		}
+	default:
+	}
+	if err := client.Unsubscribe("relay"); err != nil {
+		t.Fatalf("failed unsubscribing: %v", err)
+	}
+	want := []fakeRequest{{"subscribe", 1}, {"unsubscribe", 1}}
+	for _, w := range want {
+		if req := receive(t, fake.requests, w.method); req != w {
+			t.Errorf("expected %+v, got %+v", w, req)
+		}
+	}
+	select {
+	case req := <-fake.requests:
+		t.Errorf("unexpected request %+v", req)
+	default:
+	}
+}
+
+func newFakeKrakenWs(t *testing.T, rest http.Handler) (*fakeKrakenWs, WsClient) {
+	t.Helper()
+	// Tests share the public REST budget, which the fake needn't enforce.
+	SetRateLimitTier("", RateLimitTier{MaxCounter: 100, Decay: 100})
+	t.Cleanup(func() {
+		SetRateLimitTier("", RateLimitTier{MaxCounter: publicMaxCounter, Decay: publicDecay})
+	})
+	fake := &fakeKrakenWs{requests: make(chan fakeRequest, 8), rest: rest}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	client, err := NewWebSocketClient(context.Background(), "", "",
+		WithBaseURL(srv.URL),
+		WithWebSocketURL("ws"+strings.TrimPrefix(srv.URL, "http")))
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	return fake, client
+}
+
+func TestWsClientPartialSubscribe(t *testing.T) {
+	fake, client := newFakeKrakenWs(t, nil)
+	defer client.Close()
+	_, err := client.Subscribe("pairs", &TradeRequest{Params: TradeParams{Symbol: []string{"BTC/USD", "BAD/USD"}}})
+	if err == nil {
+		t.Fatalf("expected the refused symbol to fail the subscription")
+	}
+	want := []fakeRequest{{"subscribe", 1}, {"subscribe", 1}, {"unsubscribe", 1}}
+	for _, w := range want {
+		if req := receive(t, fake.requests, w.method); req != w {
+			t.Errorf("expected %+v, got %+v", w, req)
+		}
+	}
+	// BTC/USD was given back, so a new key has to subscribe to it again.
+	if _, err := client.Subscribe("btc", &TradeRequest{Params: TradeParams{Symbol: []string{"BTC/USD"}}}); err != nil {
+		t.Fatalf("failed subscribing: %v", err)
+	}
+	if req := receive(t, fake.requests, "subscribe"); req != (fakeRequest{"subscribe", 1}) {
+		t.Errorf("expected a new subscribe, got %+v", req)
+	}
+}
+
+func TestWsClientBookDepthConflict(t *testing.T) {
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"error":[],"result":{"XXBTZUSD":{"altname":"XBTUSD","wsname":"BTC/USD","pair_decimals":1,"lot_decimals":8}}}`))
+	})
+	fake, client := newFakeKrakenWs(t, rest)
+	defer client.Close()
+	if _, err := client.Subscribe("default", &BookRequest{Params: BookParams{Symbol: []string{"BTC/USD"}}}); err != nil {
+		t.Fatalf("failed subscribing: %v", err)
+	}
+	receive(t, fake.requests, "subscribe")
+	if _, err := client.Subscribe("ten", &BookRequest{Params: BookParams{Symbol: []string{"BTC/USD"}, Depth: 10}}); err != nil {
+		t.Errorf("same depth should share the book: %v", err)
+	}
+	if _, err := client.Subscribe("deep", &BookRequest{Params: BookParams{Symbol: []string{"BTC/USD"}, Depth: 25}}); err == nil {
+		t.Errorf("expected a second depth for the symbol to be rejected")
+	}
+	if book, err := client.Book("BTC/USD"); err != nil || book.Depth() != 10 {
+		t.Errorf("expected the depth 10 book kept, got %v %v", book, err)
+	}
+}
@@ -1,10 +1,13 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"kasegu/external/helpers"
 	"kasegu/internal/data"
 	"kasegu/internal/kraken"
+	"kasegu/internal/strategy"
 	tradeBot "kasegu/internal/trade-bot"
 	"kasegu/internal/ws"
 	"log"
@@ -21,10 +24,15 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
-const devUrl = "http://localhost:3000"
+const (
+	devUrl          = "http://localhost:3000"
+	krakenNonceFile = "krakenNonce"
+	actionTimeout   = 10 * time.Minute
+)
 
 func Loop() {
-
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	envs, err := helpers.LoadEnv([]string{"ENV"})
 	if err != nil {
 		log.Fatal(err)
@@ -39,11 +47,14 @@ func Loop() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	kClient, err := kraken.NewClient(tbd.KrakenApiKey, tbd.KrakenPrivateKey)
+	if tier, ok := kraken.RateLimitTierMap[tbd.KrakenTier]; ok {
+		kraken.SetRateLimitTier(tbd.KrakenApiKey, tier)
+	}
+	kClient, err := kraken.NewClient(tbd.KrakenApiKey, tbd.KrakenPrivateKey, kraken.WithNoncePersistence(krakenNonceFile))
 	if err != nil {
 		log.Fatal(err)
 	}
-	_, err = kClient.GetAccountBalance()
+	_, err = kClient.GetAccountBalance(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -61,24 +72,50 @@ func Loop() {
 			return true
 		}
 	}
-	tb, err := tradeBot.New(tbd.KrakenApiKey, tbd.KrakenPrivateKey)
+	s, err := strategy.New(tbd.Strategy, tbd.StrategyParams)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tb, err := tradeBot.New(tbd.KrakenApiKey, tbd.KrakenPrivateKey, s, kraken.WithDryRun(tbd.DryRun))
 	if err != nil {
 		log.Fatal(err)
 	}
 	l, err := time.LoadLocation("UTC")
 	cr := cron.New(cron.WithLocation(l))
-	_, err = cr.AddFunc("1 0 * * *", func() { tb.Action() })
+	_, err = cr.AddFunc("1 0 * * *", func() {
+		actionCtx, cancelAction := context.WithTimeout(ctx, actionTimeout)
+		defer cancelAction()
+		tb.Action(actionCtx)
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
+	var dms kraken.DeadManSwitch
 	if tbd.EnableBot {
 		cr.Start()
+		if tbd.DeadManSwitchTimeout > 0 {
+			dms, err = kraken.NewDeadManSwitch(
+				kClient,
+				time.Duration(tbd.DeadManSwitchInterval)*time.Second,
+				time.Duration(tbd.DeadManSwitchTimeout)*time.Second,
+			)
+			if err != nil {
+				log.Fatal(err)
+			}
+			dms.Start()
+		} else {
+			log.Println("WARNING: dead man's switch is disabled, resting orders will not be cancelled if the bot stops")
+		}
 	}
-	wsManager := ws.NewManager(&upgrader, tbd)
+	wsManager := ws.NewManager(ctx, &upgrader, tbd)
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
+		cancel()
+		if dms != nil {
+			dms.Stop()
+		}
 		err = data.SaveData(tbd)
 		if err != nil {
 			fmt.Println(err)
@@ -90,6 +127,8 @@ func Loop() {
 	e.IPExtractor = echo.ExtractIPDirect()
 	e.GET("/ws", wsManager.ServeWebsocket)
 	e.GET("/api/chart", func(c echo.Context) error { return getChart(c, &kClient) })
+	e.GET("/api/depth", func(c echo.Context) error { return getDepth(c, &kClient) })
+	e.GET("/api/trades", func(c echo.Context) error { return getTrades(c, &kClient) })
 	if (*envs)["ENV"] == "production" {
 		e.Static("/*", "static")
 	}
@@ -105,13 +144,68 @@ func getChart(c echo.Context, k *kraken.Kraken) error {
 	if interval == "" {
 		return c.String(http.StatusBadRequest, "interval is required")
 	}
-	i, err := strconv.ParseInt(interval, 10, 16)
+	i, err := strconv.ParseUint(interval, 10, 16)
+	if err != nil || i == 0 {
+		return c.String(http.StatusBadRequest, "interval needs to be a positive number of minutes")
+	}
+	var since int64
+	if s := c.QueryParam("since"); s != "" {
+		since, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "since needs to be an integer")
+		}
+	}
+	ohclData, err := (*k).GetCandles(c.Request().Context(), pair, time.Duration(i)*time.Minute, since)
+	if err != nil {
+		return c.String(krakenErrorStatus(err), "failed getting ohclData")
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		ohclData.Pair: ohclData.Data,
+		"last":        ohclData.Last,
+	})
+}
+
+func getDepth(c echo.Context, k *kraken.Kraken) error {
+	pair := c.QueryParam("pair")
+	if pair == "" {
+		return c.String(http.StatusBadRequest, "pair is required")
+	}
+	var count uint64
+	if s := c.QueryParam("count"); s != "" {
+		var err error
+		count, err = strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "count needs to be an integer")
+		}
+	}
+	book, err := (*k).GetOrderBook(c.Request().Context(), pair, uint16(count))
 	if err != nil {
-		return c.String(http.StatusBadRequest, "interval needs to be an integer")
+		return c.String(krakenErrorStatus(err), "failed getting order book")
+	}
+	return c.JSON(http.StatusOK, book)
+}
+
+func getTrades(c echo.Context, k *kraken.Kraken) error {
+	pair := c.QueryParam("pair")
+	if pair == "" {
+		return c.String(http.StatusBadRequest, "pair is required")
 	}
-	ohclData, err := (*k).GetOHCLData(pair, uint16(i))
+	trades, err := (*k).GetRecentTrades(c.Request().Context(), pair, c.QueryParam("since"))
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "failed getting ohclData")
+		return c.String(krakenErrorStatus(err), "failed getting trades")
+	}
+	return c.JSON(http.StatusOK, trades)
+}
+
+func krakenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, kraken.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, kraken.ErrServiceUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, kraken.ErrInvalidArguments), errors.Is(err, kraken.ErrUnknownAssetPair):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
 	}
-	return c.JSON(http.StatusOK, ohclData)
 }
@@ -0,0 +1,60 @@
+package strategy
+
+import (
+	"fmt"
+	"kasegu/internal/kraken"
+)
+
+const MACrossover = "ma_crossover"
+
+func init() {
+	Register(MACrossover, newMACrossover)
+}
+
+// maCrossover is long while the fast simple moving average of closes is above
+// the slow one.
+type maCrossover struct {
+	fast int
+	slow int
+}
+
+func newMACrossover(params Params) (Strategy, error) {
+	fast, err := params.Int("fast", 10)
+	if err != nil {
+		return nil, err
+	}
+	slow, err := params.Int("slow", 30)
+	if err != nil {
+		return nil, err
+	}
+	if fast >= slow {
+		return nil, fmt.Errorf("fast period %d must be shorter than slow period %d", fast, slow)
+	}
+	return &maCrossover{fast: fast, slow: slow}, nil
+}
+
+func (s *maCrossover) Name() string {
+	return MACrossover
+}
+
+func (s *maCrossover) Evaluate(candles []kraken.OHCLData, position Position) (*Signal, error) {
+	if len(candles) < s.slow {
+		return nil, fmt.Errorf("need %d candles for the slow average, got %d", s.slow, len(candles))
+	}
+	c := closes(candles)
+	fast, slow := sma(c, s.fast), sma(c, s.slow)
+	reason := fmt.Sprintf("sma(%d) %v vs sma(%d) %v", s.fast, fast, s.slow, slow)
+	if fast == slow {
+		return &Signal{Action: ActionHold, Reason: reason}, nil
+	}
+	return target(fast > slow, position, reason), nil
+}
+
+// sma is the simple moving average of the last period values.
+func sma(values []float64, period int) float64 {
+	var sum float64
+	for _, v := range values[len(values)-period:] {
+		sum += v
+	}
+	return sum / float64(period)
+}
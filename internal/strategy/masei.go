@@ -0,0 +1,41 @@
+package strategy
+
+import (
+	"fmt"
+	"kasegu/external/algorithms"
+	"kasegu/internal/kraken"
+)
+
+const Masei = "masei"
+
+func init() {
+	Register(Masei, func(Params) (Strategy, error) {
+		return &masei{}, nil
+	})
+}
+
+// masei trades the MASEI indicator's long condition, acting only when it
+// changes on the newest candle.
+type masei struct{}
+
+func (s *masei) Name() string {
+	return Masei
+}
+
+func (s *masei) Evaluate(candles []kraken.OHCLData, position Position) (*Signal, error) {
+	results, err := algorithms.CalculateMasei(closes(candles))
+	if err != nil {
+		return nil, fmt.Errorf("could not calculate masei: %w", err)
+	}
+	if len(*results) == 0 {
+		return &Signal{Action: ActionHold, Reason: "masei gave no results"}, nil
+	}
+	last := (*results)[len(*results)-1]
+	if int(last.Index) != len(candles)-1 {
+		return &Signal{
+			Action: ActionHold,
+			Reason: fmt.Sprintf("masei last changed at candle %d of %d", last.Index, len(candles)),
+		}, nil
+	}
+	return target(last.IsLongCond, position, fmt.Sprintf("masei long condition is %t", last.IsLongCond)), nil
+}
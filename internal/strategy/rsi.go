@@ -0,0 +1,79 @@
+package strategy
+
+import (
+	"fmt"
+	"kasegu/internal/kraken"
+)
+
+const RSIMeanReversion = "rsi_mean_reversion"
+
+func init() {
+	Register(RSIMeanReversion, newRSIMeanReversion)
+}
+
+// rsiMeanReversion buys when the RSI of closes falls below oversold and sells
+// once it rises above overbought.
+type rsiMeanReversion struct {
+	period     int
+	oversold   float64
+	overbought float64
+}
+
+func newRSIMeanReversion(params Params) (Strategy, error) {
+	period, err := params.Int("period", 14)
+	if err != nil {
+		return nil, err
+	}
+	s := &rsiMeanReversion{
+		period:     period,
+		oversold:   params.Float("oversold", 30),
+		overbought: params.Float("overbought", 70),
+	}
+	if s.oversold <= 0 || s.oversold >= s.overbought || s.overbought >= 100 {
+		return nil, fmt.Errorf("need 0 < oversold %v < overbought %v < 100", s.oversold, s.overbought)
+	}
+	return s, nil
+}
+
+func (s *rsiMeanReversion) Name() string {
+	return RSIMeanReversion
+}
+
+func (s *rsiMeanReversion) Evaluate(candles []kraken.OHCLData, position Position) (*Signal, error) {
+	if len(candles) <= s.period {
+		return nil, fmt.Errorf("need more than %d candles for the rsi, got %d", s.period, len(candles))
+	}
+	value := rsi(closes(candles), s.period)
+	reason := fmt.Sprintf("rsi(%d) %v", s.period, value)
+	switch {
+	case value < s.oversold:
+		return target(true, position, reason+" is oversold"), nil
+	case value > s.overbought:
+		return target(false, position, reason+" is overbought"), nil
+	}
+	return &Signal{Action: ActionHold, Reason: reason}, nil
+}
+
+// rsi is Wilder's relative strength index of the values, which must number
+// more than period.
+func rsi(values []float64, period int) float64 {
+	var gain, loss float64
+	for i := 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		up, down := max(change, 0), max(-change, 0)
+		if i <= period {
+			gain += up / float64(period)
+			loss += down / float64(period)
+			continue
+		}
+		gain = (gain*float64(period-1) + up) / float64(period)
+		loss = (loss*float64(period-1) + down) / float64(period)
+	}
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
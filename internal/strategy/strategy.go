@@ -0,0 +1,134 @@
+package strategy
+
+import (
+	"fmt"
+	"kasegu/internal/kraken"
+	"slices"
+	"sync"
+)
+
+const (
+	ActionHold = "hold"
+	ActionBuy  = kraken.SideBuy
+	ActionSell = kraken.SideSell
+)
+
+// Default is the strategy used when the configuration doesn't name one.
+const Default = Masei
+
+type Signal struct {
+	Action string
+	Reason string
+}
+
+// Position is what the bot currently holds of the traded coin.
+type Position struct {
+	Volume float64
+	// MinVolume is the pair's ordermin. Less than it can't be sold, so it is
+	// left over dust rather than a position.
+	MinVolume float64
+}
+
+func (p Position) Long() bool {
+	return p.Volume > 0 && p.Volume >= p.MinVolume
+}
+
+// Strategy decides what to do given candles, oldest first, and the current
+// position.
+type Strategy interface {
+	Name() string
+	Evaluate(candles []kraken.OHCLData, position Position) (*Signal, error)
+}
+
+// Params are a strategy's numeric settings, loaded from configuration.
+type Params map[string]float64
+
+// Float returns the named parameter, or def if it isn't set.
+func (p Params) Float(name string, def float64) float64 {
+	if v, ok := p[name]; ok {
+		return v
+	}
+	return def
+}
+
+// Int returns the named parameter, which must be a positive whole number, or
+// def if it isn't set.
+func (p Params) Int(name string, def int) (int, error) {
+	v, ok := p[name]
+	if !ok {
+		return def, nil
+	}
+	if v < 1 || v != float64(int(v)) {
+		return 0, fmt.Errorf("parameter %s must be a positive whole number, got %v", name, v)
+	}
+	return int(v), nil
+}
+
+type Factory func(params Params) (Strategy, error)
+
+var (
+	registry   = map[string]Factory{}
+	registryMu sync.RWMutex
+)
+
+// Register makes a strategy available to New under name. It panics if the
+// name is already taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("strategy %s registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// New creates the strategy registered under name, or the default strategy
+// when name is empty.
+func New(name string, params Params) (Strategy, error) {
+	if name == "" {
+		name = Default
+	}
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %s, expected one of %v", name, Names())
+	}
+	s, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("error creating strategy %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Names returns the registered strategies, sorted.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// target turns the position a strategy wants into a signal, holding when the
+// bot is already there.
+func target(long bool, position Position, reason string) *Signal {
+	switch {
+	case long && !position.Long():
+		return &Signal{Action: ActionBuy, Reason: reason}
+	case !long && position.Long():
+		return &Signal{Action: ActionSell, Reason: reason}
+	}
+	return &Signal{Action: ActionHold, Reason: reason}
+}
+
+func closes(candles []kraken.OHCLData) []float64 {
+	c := make([]float64, len(candles))
+	for i, v := range candles {
+		c[i] = v.Close
+	}
+	return c
+}
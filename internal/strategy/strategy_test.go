@@ -0,0 +1,86 @@
+package strategy
+
+import (
+	"kasegu/internal/kraken"
+	"testing"
+)
+
+func candlesFromCloses(closes ...float64) []kraken.OHCLData {
+	c := make([]kraken.OHCLData, len(closes))
+	for i, v := range closes {
+		c[i] = kraken.OHCLData{Time: float64(i * 60), Close: v}
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	s, err := New("", nil)
+	if err != nil {
+		t.Fatalf("failed creating default strategy: %v", err)
+	}
+	if s.Name() != Default {
+		t.Errorf("expected %s, got %s", Default, s.Name())
+	}
+	if _, err := New("nope", nil); err == nil {
+		t.Errorf("expected unknown strategy to be rejected")
+	}
+	if _, err := New(MACrossover, Params{"fast": 30, "slow": 10}); err == nil {
+		t.Errorf("expected fast period longer than slow to be rejected")
+	}
+	if _, err := New(RSIMeanReversion, Params{"period": 2.5}); err == nil {
+		t.Errorf("expected fractional period to be rejected")
+	}
+}
+
+func TestMACrossover(t *testing.T) {
+	s, err := New(MACrossover, Params{"fast": 2, "slow": 4})
+	if err != nil {
+		t.Fatalf("failed creating strategy: %v", err)
+	}
+	rising := candlesFromCloses(1, 2, 3, 4, 5)
+	falling := candlesFromCloses(5, 4, 3, 2, 1)
+	tests := []struct {
+		candles  []kraken.OHCLData
+		position Position
+		want     string
+	}{
+		{rising, Position{}, ActionBuy},
+		{rising, Position{Volume: 1}, ActionHold},
+		{falling, Position{Volume: 1}, ActionSell},
+		{falling, Position{}, ActionHold},
+		{rising, Position{Volume: 0.4, MinVolume: 1}, ActionBuy},
+		{falling, Position{Volume: 0.4, MinVolume: 1}, ActionHold},
+	}
+	for _, tt := range tests {
+		sig, err := s.Evaluate(tt.candles, tt.position)
+		if err != nil {
+			t.Fatalf("failed evaluating: %v", err)
+		}
+		if sig.Action != tt.want {
+			t.Errorf("expected %s, got %s (%s)", tt.want, sig.Action, sig.Reason)
+		}
+	}
+	if _, err := s.Evaluate(rising[:3], Position{}); err == nil {
+		t.Errorf("expected too few candles to be rejected")
+	}
+}
+
+func TestRSI(t *testing.T) {
+	if v := rsi([]float64{1, 2, 3, 4}, 3); v != 100 {
+		t.Errorf("expected rsi of 100 for only gains, got %v", v)
+	}
+	if v := rsi([]float64{1, 2, 1}, 2); v != 50 {
+		t.Errorf("expected rsi of 50 for equal gains and losses, got %v", v)
+	}
+	s, err := New(RSIMeanReversion, Params{"period": 3})
+	if err != nil {
+		t.Fatalf("failed creating strategy: %v", err)
+	}
+	sig, err := s.Evaluate(candlesFromCloses(4, 3, 2, 1), Position{})
+	if err != nil {
+		t.Fatalf("failed evaluating: %v", err)
+	}
+	if sig.Action != ActionBuy {
+		t.Errorf("expected oversold to buy, got %s (%s)", sig.Action, sig.Reason)
+	}
+}
@@ -1,75 +1,105 @@
 package trade_bot
 
 import (
+	"context"
 	"fmt"
-	"kasegu/external/algorithms"
 	"kasegu/internal/kraken"
+	"kasegu/internal/strategy"
 	"log"
 	"strconv"
+	"time"
 )
 
 const (
 	baseCurrency = "ZUSD"
 	quoteCoin    = "PENGU"
 	tradePair    = "PENGU/USD"
+	interval     = 24 * time.Hour
+	maxCandles   = 720
 )
 
 type Client interface {
-	Action()
-	Buy()
-	Sell()
+	Action(ctx context.Context)
+	Buy(ctx context.Context)
+	Sell(ctx context.Context)
 }
 
 type client struct {
-	kClient *kraken.Kraken
+	kClient  *kraken.Kraken
+	strategy strategy.Strategy
+	candles  []kraken.OHCLData
+	last     int64
 }
 
-func New(apiKeyEnv string, privateKeyEnv string) (Client, error) {
-	c, err := kraken.NewClient(apiKeyEnv, privateKeyEnv)
+func New(apiKeyEnv string, privateKeyEnv string, s strategy.Strategy, opts ...kraken.Option) (Client, error) {
+	c, err := kraken.NewClient(apiKeyEnv, privateKeyEnv, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("could not create kraken client: %w", err)
 	}
-	return &client{&c}, nil
+	return &client{kClient: &c, strategy: s}, nil
 }
 
-func (c *client) Action() {
+func (c *client) Action(ctx context.Context) {
 	log.Printf("Commening Action, BaseCurrency: %s | QuoteCoin: %s | TradePair: %s", baseCurrency, quoteCoin, tradePair)
-	data, err := (*c.kClient).GetOHCLData(tradePair, 1440)
+	data, err := (*c.kClient).GetCandles(ctx, tradePair, interval, c.last)
 	if err != nil {
 		//TODO: Make it keep trying, probably
 		log.Printf("could not get data from kraken: %v", err)
 		return
 	}
-	p, err := kraken.ParseOHCLData(data)
+	c.candles = kraken.MergeOHCLData(c.candles, data.Data, maxCandles)
+	c.last = data.Last
+	position, err := c.position(ctx)
 	if err != nil {
-		log.Printf("could not parse data from kraken: %v", err)
+		log.Printf("could not get position: %v", err)
 		return
 	}
-	fa := make([]float64, len(*p))
-	for i, v := range *p {
-		fa[i] = v.Close
-	}
-	masei, err := algorithms.CalculateMasei(fa)
+	signal, err := c.strategy.Evaluate(c.candles, *position)
 	if err != nil {
-		log.Printf("could not calculate masei: %v", err)
+		log.Printf("could not evaluate %s: %v", c.strategy.Name(), err)
 		return
 	}
-	mi := uint32(len(*masei) - 1)
-	index := (*masei)[mi].Index
-	pi := len(*p) - 1
-	log.Printf("MaseiIndex: %d | PIndex: %d", index, uint32(pi))
-	if index == uint32(pi) {
-		if (*masei)[mi].IsLongCond {
-			c.Buy()
-		} else {
-			c.Sell()
+	log.Printf("Strategy: %s | Signal: %s | Reason: %s", c.strategy.Name(), signal.Action, signal.Reason)
+	switch signal.Action {
+	case strategy.ActionBuy:
+		c.Buy(ctx)
+	case strategy.ActionSell:
+		c.Sell(ctx)
+	}
+}
+
+// position returns how much of the quote coin the account holds, along with
+// the least of it the pair can trade.
+func (c *client) position(ctx context.Context) (*strategy.Position, error) {
+	p, err := (*c.kClient).AssetPair(ctx, tradePair)
+	if err != nil {
+		return nil, fmt.Errorf("could not get pair metadata: %w", err)
+	}
+	position := &strategy.Position{}
+	if p.OrderMin != "" {
+		position.MinVolume, err = p.OrderMin.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("could not parse order minimum: %w", err)
 		}
 	}
+	bal, err := (*c.kClient).GetAccountBalance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get account balance: %w", err)
+	}
+	amt, ok := (*bal)[quoteCoin]
+	if !ok {
+		return position, nil
+	}
+	position.Volume, err = strconv.ParseFloat(amt, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse balance: %w", err)
+	}
+	return position, nil
 }
 
-func (c *client) addOrder(pair string, asset string, transactionType string) error {
+func (c *client) addOrder(ctx context.Context, pair string, asset string, transactionType string) error {
 	fmt.Printf("%sing trade ...", transactionType)
-	bal, err := (*c.kClient).GetAccountBalance()
+	bal, err := (*c.kClient).GetAccountBalance(ctx)
 	if err != nil {
 		return fmt.Errorf("could not get account balance: %w", err)
 	}
@@ -79,7 +109,7 @@ func (c *client) addOrder(pair string, asset string, transactionType string) err
 		return fmt.Errorf("could not get account to invest")
 	}
 	if transactionType == "buy" {
-		ti, err := (*c.kClient).GetTickerInformation(pair)
+		ti, err := (*c.kClient).GetTickerInformation(ctx, pair)
 		if err != nil {
 			return fmt.Errorf("could not get ticker information: %w", err)
 		}
@@ -99,30 +129,54 @@ func (c *client) addOrder(pair string, asset string, transactionType string) err
 		amt = fmt.Sprint(af / p)
 		fmt.Println(amt)
 	}
-	err = (*c.kClient).AddOrder(pair, amt, transactionType)
+	c.logSlippage(ctx, pair, amt, transactionType)
+	order := &kraken.OrderRequest{
+		Pair:          pair,
+		Side:          transactionType,
+		OrderType:     kraken.OrderTypeMarket,
+		Volume:        amt,
+		ClientOrderID: kraken.NewClientOrderID(),
+	}
+	res, err := (*c.kClient).AddOrder(ctx, order)
 	if err != nil {
-		log.Printf("order had an error: %v, retrying...", err)
-		for i := 1; i <= 3; i++ {
-			err = (*c.kClient).AddOrder(pair, amt, transactionType)
-			if err == nil {
-				return fmt.Errorf("could not make the trade")
-			}
-		}
+		return fmt.Errorf("order had an error: %w", err)
+	}
+	if len(res.TxIDs) == 0 {
+		log.Printf("order validated without being placed: %s", res.Description.Order)
+		return nil
 	}
 	log.Println("successfully made the trade")
 	return nil
 }
 
-func (c *client) Buy() {
-	err := c.addOrder(tradePair, baseCurrency, "buy")
+func (c *client) Buy(ctx context.Context) {
+	err := c.addOrder(ctx, tradePair, baseCurrency, "buy")
 	if err != nil {
 		log.Printf("could not make the trade: %v", err)
 	}
 }
 
-func (c *client) Sell() {
-	err := c.addOrder(tradePair, quoteCoin, "sell")
+func (c *client) Sell(ctx context.Context) {
+	err := c.addOrder(ctx, tradePair, quoteCoin, "sell")
 	if err != nil {
 		log.Printf("could not make the trade: %v", err)
 	}
 }
+
+func (c *client) logSlippage(ctx context.Context, pair string, amt string, transactionType string) {
+	v, err := strconv.ParseFloat(amt, 64)
+	if err != nil {
+		return
+	}
+	book, err := (*c.kClient).GetOrderBook(ctx, pair, 100)
+	if err != nil {
+		log.Printf("could not get order book: %v", err)
+		return
+	}
+	fill, err := book.EstimateFill(transactionType, v)
+	if err != nil {
+		log.Printf("could not estimate fill: %v", err)
+		return
+	}
+	log.Printf("estimated average fill price: %v", fill)
+}
@@ -1,10 +1,7 @@
 package ws
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
-	"kasegu/external/helpers"
 	"kasegu/internal/kraken"
 	"log"
 	"time"
@@ -15,24 +12,21 @@ import (
 const (
 	pongWait     = 10 * time.Second
 	pingInterval = (pongWait * 9) / 10
+	egressBuffer = 256
 )
 
 type websocketClient struct {
 	conn    *websocket.Conn
 	manager *websocketManager
 	egress  chan event
-	kClient *kraken.WsClient
-	cancel  *context.CancelFunc
 }
 
 func newClient(conn *websocket.Conn, wsManager *websocketManager) *websocketClient {
-	return &websocketClient{conn: conn, manager: wsManager, egress: make(chan event)}
+	return &websocketClient{conn: conn, manager: wsManager, egress: make(chan event, egressBuffer)}
 }
 
 func (c *websocketClient) cleanup() {
-	if c.kClient != nil {
-		c.destroyKrakenClient()
-	}
+	c.manager.feed.drop(c)
 	c.manager.removeClient(c)
 }
 
@@ -60,6 +54,7 @@ func (c *websocketClient) readMessages() {
 		}
 		if err := c.manager.routeEvent(&request, c); err != nil {
 			log.Printf("websocket routing error: %v", err)
+			c.sendError(err)
 			continue
 		}
 	}
@@ -96,45 +91,32 @@ func (c *websocketClient) writeMessages() {
 	}
 }
 
-func (c *websocketClient) createKrakenClient(apiKeyEnv string, privateKeyEnv string) error {
-	client, err := kraken.NewWebSocketClient(apiKeyEnv, privateKeyEnv)
+// sendKrakenEvent queues ev for the browser without blocking the shared feed.
+// Events are dropped for clients too slow to keep up.
+func (c *websocketClient) sendKrakenEvent(ev *kraken.Event) {
+	evJson, err := json.Marshal(ev)
 	if err != nil {
-		return fmt.Errorf("failed to create kraken websocket client: %w", err)
+		log.Printf("json marshal error: %v\n", err)
+		return
 	}
-	c.kClient = &client
-	return nil
-}
-
-func (c *websocketClient) destroyKrakenClient() {
-	if c.cancel != nil {
-		(*c.cancel)()
-		c.cancel = nil
+	select {
+	case c.egress <- event{Type: eventKraken, Payload: evJson}:
+	default:
+		log.Println("websocket client too slow, dropping kraken event")
 	}
-	helpers.CheckedClose(*c.kClient)
-	c.kClient = nil
-	return
 }
 
-func (c *websocketClient) deliverKrakenEvents(ctx context.Context) {
-	for {
-		select {
-		case ev, ok := <-(*(*c.kClient).BindResponse()):
-			if !ok {
-				log.Println("kraken event delivery channel closed")
-				return
-			}
-			evJson, err := json.Marshal(ev)
-			if err != nil {
-				log.Printf("json marshal error: %v\n", err)
-				continue
-			}
-			c.egress <- event{
-				Type:    eventKraken,
-				Payload: evJson,
-			}
-		case <-ctx.Done():
-			return
-		}
+// sendError lets the browser know a request it made failed.
+func (c *websocketClient) sendError(err error) {
+	payload, mErr := json.Marshal(errorEvent{Message: err.Error()})
+	if mErr != nil {
+		log.Printf("json marshal error: %v\n", mErr)
+		return
+	}
+	select {
+	case c.egress <- event{Type: eventError, Payload: payload}:
+	default:
+		log.Println("websocket client too slow, dropping error")
 	}
 }
 
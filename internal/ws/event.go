@@ -14,8 +14,13 @@ type eventHandler func(event *event, c *websocketClient) error
 const (
 	eventSendMessage = "send_message"
 	eventKraken      = "kraken"
+	eventError       = "error"
 )
 
+type errorEvent struct {
+	Message string `json:"message"`
+}
+
 type sendMessageEvent struct {
 	Message string `json:"message"`
 	From    string `json:"from"`
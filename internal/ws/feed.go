@@ -0,0 +1,319 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kasegu/external/helpers"
+	"kasegu/internal/kraken"
+	"log"
+	"maps"
+	"sync"
+	"time"
+)
+
+// subscriptionKey identifies one upstream subscription. Browser requests for
+// several symbols are split into one subscription per symbol.
+type subscriptionKey struct {
+	channel  string
+	symbol   string
+	interval uint16
+	// params holds the request's other parameters, such as a book's depth,
+	// as canonical JSON. Keys differing only in params share Kraken's
+	// subscription, which refuses a book at a second depth for a symbol.
+	params string
+}
+
+func (k subscriptionKey) String() string {
+	return fmt.Sprintf("%s:%s:%d:%s", k.channel, k.symbol, k.interval, k.params)
+}
+
+// covers reports whether an unsubscribe for k should release other. Requests
+// that leave out the parameters release every subscription to the symbol.
+func (k subscriptionKey) covers(other subscriptionKey) bool {
+	if k.params != "" || (k.interval != 0 && k.interval != other.interval) {
+		return k == other
+	}
+	return k.channel == other.channel && k.symbol == other.symbol
+}
+
+// keyParams are the request parameters that don't change what is streamed or
+// are already part of the key.
+var keyParams = []string{"channel", "symbol", "interval", "snapshot", "token"}
+
+// krakenFeed owns the single upstream connection to Kraken shared by every
+// browser client. Each subscription is made upstream once and its events are
+// fanned out to all the clients that asked for it.
+type krakenFeed struct {
+	ctx     context.Context
+	kClient kraken.WsClient
+	// rest backfills candles for intervals Kraken doesn't serve.
+	rest kraken.Kraken
+	// state is the last connection state sent to clients.
+	state string
+	// opMu serializes changes to subscriptions and the upstream connection.
+	// Subscribing waits on Kraken, so the embedded lock, which deliver needs,
+	// only guards subs itself and is never held while waiting.
+	opMu sync.Mutex
+	// closers end the upstream subscription behind each key.
+	closers map[subscriptionKey]func() error
+	subs    map[subscriptionKey]map[*websocketClient]bool
+	// snapshots holds each key's last snapshot, sent to clients joining it
+	// since Kraken only sends one when the key is opened.
+	snapshots map[subscriptionKey]kraken.Event
+	sync.RWMutex
+}
+
+func newKrakenFeed(ctx context.Context) *krakenFeed {
+	return &krakenFeed{
+		ctx:       ctx,
+		closers:   make(map[subscriptionKey]func() error),
+		subs:      make(map[subscriptionKey]map[*websocketClient]bool),
+		snapshots: make(map[subscriptionKey]kraken.Event),
+	}
+}
+
+func (f *krakenFeed) subscribe(c *websocketClient, key subscriptionKey, br kraken.BaseRequest) error {
+	f.opMu.Lock()
+	defer f.opMu.Unlock()
+	if clients, ok := f.subs[key]; ok {
+		// The snapshot is sent under the lock deliver needs, so the joiner
+		// gets no update before it.
+		f.Lock()
+		defer f.Unlock()
+		if !clients[c] {
+			if ev, ok := f.snapshot(key); ok {
+				c.sendKrakenEvent(ev)
+			}
+		}
+		clients[c] = true
+		return nil
+	}
+	if err := f.connect(); err != nil {
+		return err
+	}
+	events, err := f.open(key, br)
+	if err != nil {
+		f.disconnectIfIdle()
+		return fmt.Errorf("subscribe error: %w", err)
+	}
+	f.Lock()
+	f.subs[key] = map[*websocketClient]bool{c: true}
+	f.Unlock()
+	go f.deliver(key, events)
+	return nil
+}
+
+func (f *krakenFeed) unsubscribe(c *websocketClient, key subscriptionKey) error {
+	f.opMu.Lock()
+	defer f.opMu.Unlock()
+	for held, clients := range f.subs {
+		if clients[c] && key.covers(held) {
+			if err := f.release(c, held); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// drop releases every subscription held by c.
+func (f *krakenFeed) drop(c *websocketClient) {
+	f.opMu.Lock()
+	defer f.opMu.Unlock()
+	for key, clients := range f.subs {
+		if clients[c] {
+			if err := f.release(c, key); err != nil {
+				log.Printf("kraken feed release error: %v", err)
+			}
+		}
+	}
+}
+
+// release removes c from key's subscribers and unsubscribes upstream once
+// nobody is left.
+func (f *krakenFeed) release(c *websocketClient, key subscriptionKey) error {
+	clients, ok := f.subs[key]
+	if !ok || !clients[c] {
+		return nil
+	}
+	f.Lock()
+	delete(clients, c)
+	empty := len(clients) == 0
+	if empty {
+		delete(f.subs, key)
+		delete(f.snapshots, key)
+	}
+	f.Unlock()
+	if !empty {
+		return nil
+	}
+	defer f.disconnectIfIdle()
+	closer := f.closers[key]
+	delete(f.closers, key)
+	if err := closer(); err != nil {
+		return fmt.Errorf("unsubscribe error: %w", err)
+	}
+	return nil
+}
+
+// open subscribes upstream. Candles at intervals Kraken doesn't serve are
+// built from the trade channel instead.
+func (f *krakenFeed) open(key subscriptionKey, br kraken.BaseRequest) (<-chan kraken.Event, error) {
+	if key.channel == "ohlc" && !kraken.IsOHLCInterval(key.interval) {
+		if key.interval == 0 {
+			return nil, fmt.Errorf("ohlc interval is required")
+		}
+		cf, err := kraken.NewCandleFeed(f.ctx, f.rest, f.kClient, key.symbol, time.Duration(key.interval)*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		f.closers[key] = cf.Close
+		return cf.Events(), nil
+	}
+	events, err := f.kClient.Subscribe(key.String(), br)
+	if err != nil {
+		return nil, err
+	}
+	f.closers[key] = func() error { return f.kClient.Unsubscribe(key.String()) }
+	return events, nil
+}
+
+func (f *krakenFeed) connect() error {
+	if f.kClient != nil {
+		return nil
+	}
+	if f.rest == nil {
+		rest, err := kraken.NewClient("", "")
+		if err != nil {
+			return fmt.Errorf("failed to create kraken client: %w", err)
+		}
+		f.rest = rest
+	}
+	client, err := kraken.NewWebSocketClient(f.ctx, "", "")
+	if err != nil {
+		return fmt.Errorf("failed to create kraken websocket client: %w", err)
+	}
+	f.kClient = client
+	return nil
+}
+
+func (f *krakenFeed) disconnectIfIdle() {
+	if f.kClient == nil || len(f.subs) > 0 {
+		return
+	}
+	helpers.CheckedClose(f.kClient)
+	f.kClient = nil
+}
+
+// deliver fans key's stream out until it is closed by unsubscribing.
+func (f *krakenFeed) deliver(key subscriptionKey, events <-chan kraken.Event) {
+	for ev := range events {
+		if ev.Channel == kraken.ConnectionChannel {
+			f.routeState(&ev)
+			continue
+		}
+		if ev.Type == "snapshot" {
+			f.Lock()
+			if _, ok := f.subs[key]; ok {
+				f.snapshots[key] = ev
+			}
+			f.Unlock()
+		}
+		f.RLock()
+		for c := range f.subs[key] {
+			c.sendKrakenEvent(&ev)
+		}
+		f.RUnlock()
+	}
+}
+
+// snapshot returns what a client joining key should start from. Books are
+// taken from the local book, which has every update since Kraken's snapshot
+// applied.
+func (f *krakenFeed) snapshot(key subscriptionKey) (*kraken.Event, bool) {
+	if key.channel != "book" {
+		ev, ok := f.snapshots[key]
+		return &ev, ok
+	}
+	book, err := f.kClient.Book(key.symbol)
+	if err != nil || !book.Synced() {
+		return nil, false
+	}
+	data, err := json.Marshal([]kraken.BookUpdate{book.Snapshot()})
+	if err != nil {
+		log.Printf("json marshal error: %v\n", err)
+		return nil, false
+	}
+	return &kraken.Event{Channel: "book", Type: "snapshot", Data: data}, true
+}
+
+// routeState tells every subscribed client about a change in the upstream
+// connection. Every stream reports it, so only the first report is sent.
+func (f *krakenFeed) routeState(ev *kraken.Event) {
+	f.Lock()
+	defer f.Unlock()
+	if ev.Type == f.state {
+		return
+	}
+	f.state = ev.Type
+	notified := make(map[*websocketClient]bool)
+	for _, clients := range f.subs {
+		for c := range clients {
+			if !notified[c] {
+				notified[c] = true
+				c.sendKrakenEvent(ev)
+			}
+		}
+	}
+}
+
+// splitRequest breaks a browser subscription request into one request per
+// symbol, keyed by the subscription each one makes.
+func splitRequest(payload json.RawMessage) (map[subscriptionKey]json.RawMessage, error) {
+	var req struct {
+		Method string         `json:"method"`
+		Params map[string]any `json:"params"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("kraken request unmarshal error: %w", err)
+	}
+	var params struct {
+		Channel  string   `json:"channel"`
+		Symbol   []string `json:"symbol"`
+		Interval uint16   `json:"interval"`
+	}
+	if err := json.Unmarshal(payload, &struct {
+		Params any `json:"params"`
+	}{&params}); err != nil {
+		return nil, fmt.Errorf("kraken request unmarshal error: %w", err)
+	}
+	other := maps.Clone(req.Params)
+	for _, p := range keyParams {
+		delete(other, p)
+	}
+	var otherJson []byte
+	if len(other) > 0 {
+		var err error
+		// Maps marshal with sorted keys, so equal parameters give equal keys.
+		otherJson, err = json.Marshal(other)
+		if err != nil {
+			return nil, fmt.Errorf("kraken request marshal error: %w", err)
+		}
+	}
+	key := subscriptionKey{channel: params.Channel, interval: params.Interval, params: string(otherJson)}
+	if len(params.Symbol) == 0 {
+		return map[subscriptionKey]json.RawMessage{key: payload}, nil
+	}
+	split := make(map[subscriptionKey]json.RawMessage, len(params.Symbol))
+	for _, symbol := range params.Symbol {
+		req.Params["symbol"] = []string{symbol}
+		raw, err := json.Marshal(req)
+		if err != nil {
+			return nil, fmt.Errorf("kraken request marshal error: %w", err)
+		}
+		key.symbol = symbol
+		split[key] = raw
+	}
+	return split, nil
+}
@@ -0,0 +1,72 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"kasegu/internal/kraken"
+	"testing"
+	"time"
+)
+
+// fakeWsClient streams whatever the test sends on events to the one key it
+// has subscribed.
+type fakeWsClient struct {
+	kraken.WsClient
+	events chan kraken.Event
+}
+
+func (f *fakeWsClient) Subscribe(string, kraken.BaseRequest) (<-chan kraken.Event, error) {
+	return f.events, nil
+}
+
+func (f *fakeWsClient) Unsubscribe(string) error {
+	close(f.events)
+	return nil
+}
+
+func (f *fakeWsClient) Close() error {
+	return nil
+}
+
+func receiveKraken(t *testing.T, c *websocketClient) kraken.Event {
+	t.Helper()
+	select {
+	case e := <-c.egress:
+		var ev kraken.Event
+		if err := json.Unmarshal(e.Payload, &ev); err != nil {
+			t.Fatalf("failed unmarshaling event: %v", err)
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for an event")
+	}
+	return kraken.Event{}
+}
+
+func TestFeedSnapshotForJoiningClient(t *testing.T) {
+	feed := newKrakenFeed(context.Background())
+	upstream := &fakeWsClient{events: make(chan kraken.Event, 1)}
+	feed.kClient = upstream
+	key := subscriptionKey{channel: "ticker", symbol: "BTC/USD"}
+	first := &websocketClient{egress: make(chan event, egressBuffer)}
+	if err := feed.subscribe(first, key, &kraken.TickerRequest{}); err != nil {
+		t.Fatalf("failed subscribing: %v", err)
+	}
+	upstream.events <- kraken.Event{Channel: "ticker", Type: "snapshot", Data: json.RawMessage(`[{"symbol":"BTC/USD","last":100}]`)}
+	if ev := receiveKraken(t, first); ev.Type != "snapshot" {
+		t.Fatalf("expected the first client to get the snapshot, got %+v", ev)
+	}
+	upstream.events <- kraken.Event{Channel: "ticker", Type: "update", Data: json.RawMessage(`[{"symbol":"BTC/USD","last":101}]`)}
+	receiveKraken(t, first)
+
+	second := &websocketClient{egress: make(chan event, egressBuffer)}
+	if err := feed.subscribe(second, key, &kraken.TickerRequest{}); err != nil {
+		t.Fatalf("failed joining: %v", err)
+	}
+	ev := receiveKraken(t, second)
+	if ev.Channel != "ticker" || ev.Type != "snapshot" || string(ev.Data) != `[{"symbol":"BTC/USD","last":100}]` {
+		t.Errorf("expected the joining client to get the snapshot, got %+v", ev)
+	}
+	feed.drop(first)
+	feed.drop(second)
+}
@@ -25,15 +25,19 @@ type websocketManager struct {
 	sync.Mutex
 	evHandlers map[string]eventHandler
 	tbd        *data.Data
+	ctx        context.Context
+	feed       *krakenFeed
 }
 
-func NewManager(upgrader *websocket.Upgrader, d *data.Data) WebsocketManager {
+func NewManager(ctx context.Context, upgrader *websocket.Upgrader, d *data.Data) WebsocketManager {
 	m := &websocketManager{
+		ctx:        ctx,
 		clients:    make(map[*websocketClient]bool),
 		ips:        make(map[string]*websocketClient),
 		upgrader:   upgrader,
 		evHandlers: make(map[string]eventHandler),
 		tbd:        d,
+		feed:       newKrakenFeed(ctx),
 	}
 	m.setupEventHandlers()
 	return m
@@ -89,42 +93,31 @@ func sendKraken(event *event, c *websocketClient) error {
 	if err != nil {
 		return err
 	}
-	br, ok := kraken.RequestHandlerMap[channel]
+	handler, ok := kraken.RequestHandlerMap[channel]
 	if !ok {
 		return fmt.Errorf("channel %s not supported", channel)
 	}
-	msg, err := br(event.Payload)
+	requests, err := splitRequest(event.Payload)
 	if err != nil {
 		return err
 	}
-	if method == "subscribe" {
-		if c.kClient == nil {
-			err := c.createKrakenClient(c.manager.tbd.KrakenApiKey, c.manager.tbd.KrakenApiKey)
+	for key, req := range requests {
+		switch method {
+		case "subscribe":
+			br, err := handler(req)
 			if err != nil {
-				return fmt.Errorf("create kraken client error: %v", err)
+				return err
 			}
-			ctx, cancel := context.WithCancel(context.Background())
-			go c.deliverKrakenEvents(ctx)
-			c.cancel = &cancel
-		}
-		err := (*c.kClient).Subscribe(channel, msg)
-		if err != nil {
-			return fmt.Errorf("subscribe error: %v", err)
-		}
-	} else if method == "unsubscribe" {
-		if c.kClient == nil {
-			log.Printf("Kraken client doesn't exist")
-			return nil
-		}
-		err := (*c.kClient).Unsubscribe(channel)
-		if err != nil {
-			return fmt.Errorf("unsubscribe error: %v", err)
-		}
-		if !(*c.kClient).AreThereActiveSubscriptions() {
-			c.destroyKrakenClient()
+			if err := c.manager.feed.subscribe(c, key, br); err != nil {
+				return err
+			}
+		case "unsubscribe":
+			if err := c.manager.feed.unsubscribe(c, key); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("method %s not supported", method)
 		}
-	} else {
-		return fmt.Errorf("method %s not supported", method)
 	}
 	return nil
 }
@@ -4,12 +4,20 @@ import type {ChartData} from "@/lib/types.ts";
 const api_url = import.meta.env.MODE === "development" ? "http://localhost:1323/api" : "/api";
 
 
-export interface BTCChart{
-    XXBTZUSD: ChartData[]
+export interface ChartResponse {
     last: number
+    [pair: string]: ChartData[] | number
 }
 
-export async function getChart(pair: string, interval: number): Promise<BTCChart | null> {
+// chartCandles returns the candles of a getChart response, which are keyed by
+// Kraken's name for the pair.
+export function chartCandles(res: ChartResponse | null): ChartData[] {
+    if (!res) return [];
+    const key = Object.keys(res).find(k => k !== "last");
+    return key ? res[key] as ChartData[] : [];
+}
+
+export async function getChart(pair: string, interval: number): Promise<ChartResponse | null> {
     console.log("Getting Chart");
     try {
         return await axios.get(api_url + "/chart?pair=" + pair + "&interval=" + interval,
@@ -1,9 +1,7 @@
 import {createChart, CandlestickSeries, ColorType, type CandlestickData, type UTCTimestamp} from "lightweight-charts";
 import {useEffect, useRef} from "react";
 import {type ChartData, DestructureChartData, type LiveChartData} from "@/lib/types.ts";
-import {getUTCDate} from "@/lib/helpers.ts";
-
-const ws_url = import.meta.env.MODE === "development" ? "ws://localhost:1323/ws" : "/ws";
+import {subscribe} from "@/lib/socket.ts";
 
 export class ChartColors {
     backgroundColor = 'white';
@@ -26,32 +24,24 @@ function ToCandlestickData(data: ChartData[]): CandlestickData[] {
     })
 }
 
-export default function Chart({chartData, chartColors}: {chartData: ChartData[], chartColors: ChartColors}) {
+interface ChartProps {
+    symbol: string;
+    interval: number;
+    chartData: ChartData[];
+    chartColors: ChartColors;
+    height?: number;
+}
+
+export default function Chart({symbol, interval, chartData, chartColors, height = window.innerHeight - 40}: ChartProps) {
     const chartContainerRef = useRef<HTMLDivElement>(null);
     useEffect(
         () => {
-            const socket = new WebSocket(ws_url);
-            socket.onopen = async () => {
-                socket.send(JSON.stringify({
-                    "type": "kraken",
-                    "payload": {
-                        "method": "subscribe",
-                        "params": {
-                            "channel": "ohlc",
-                            "symbol": [
-                                "BTC/USD"
-                            ],
-                            "interval": 1440
-                        }
-                    }
-                }));
-            }
             const handleResize = () => {
                 if (!chartContainerRef.current) return;
                 chart.applyOptions(
                     {
                         width: chartContainerRef.current.clientWidth,
-                        height: window.innerHeight - 40
+                        height: height
                     }
                 );
             };
@@ -62,56 +52,33 @@ export default function Chart({chartData, chartColors}: {chartData: ChartData[],
                     textColor: chartColors.textColor,
                 },
                 width: chartContainerRef.current.clientWidth,
-                height: window.innerHeight - 40
+                height: height
             });
             chart.timeScale().fitContent();
             const newSeries = chart.addSeries(CandlestickSeries, { baseLineColor: chartColors.lineColor });
             newSeries.setData(ToCandlestickData(chartData));
-            console.log(newSeries);
             window.addEventListener('resize', handleResize);
-            socket.onmessage = (e: MessageEvent) => {
-                const data = JSON.parse(e.data) as LiveChartData;
-                if (data.payload.channel !== 'ohlc') return;
-                console.log(data)
-                const index = data.payload.data.length - 1
-                //TODO: The Date takes TZ into account, undo that so it is UTC+0
-                const d = getUTCDate(new Date(data.payload.data[index].interval_begin))
-                console.log(d)
-                const ds = `${d.getFullYear()}-${(d.getMonth() + 1).toString().padStart(2, '0')}-${d.getDate().toString().padStart(2, '0')}`;
-                console.log(ds)
-                newSeries.update({
-                    time: ds,
-                    open: Number(data.payload.data[index].open),
-                    high: Number(data.payload.data[index].high),
-                    low: Number(data.payload.data[index].low),
-                    close: Number(data.payload.data[index].close),
-                })
-            };
+            const unsubscribe = subscribe({channel: "ohlc", symbol: symbol, interval: interval}, (data: LiveChartData) => {
+                data.payload.data
+                    .filter(c => c.symbol === symbol && c.interval === interval)
+                    .forEach(c => newSeries.update({
+                        time: (new Date(c.interval_begin).getTime() / 1000) as UTCTimestamp,
+                        open: Number(c.open),
+                        high: Number(c.high),
+                        low: Number(c.low),
+                        close: Number(c.close),
+                    }));
+            });
             return () => {
+                unsubscribe();
                 window.removeEventListener('resize', handleResize);
                 chart.remove();
-                socket.onmessage = null;
-                if (socket.readyState !== WebSocket.OPEN) return;
-                socket.send(JSON.stringify({
-                    "type": "kraken",
-                    "payload": {
-                        "method": "unsubscribe",
-                        "params": {
-                            "channel": "ohlc",
-                            "symbol": [
-                                "BTC/USD"
-                            ],
-                            "interval": 1440
-                        }
-                    }
-                }));
-                socket.close()
             };
         },
-        [chartData, chartColors, chartContainerRef.current]
+        [symbol, interval, chartData, chartColors, height]
     );
 
     return (
         <div ref={chartContainerRef}/>
     )
-}
\ No newline at end of file
+}
@@ -0,0 +1,115 @@
+import type {LiveChartData} from "@/lib/types.ts";
+
+const ws_url = import.meta.env.MODE === "development" ? "ws://localhost:1323/ws" : "/ws";
+
+export type KrakenParams = {
+    channel: string;
+    symbol: string;
+    [param: string]: unknown;
+}
+
+type Handler = (data: LiveChartData) => void;
+
+interface Subscription {
+    params: KrakenParams;
+    handlers: Set<Handler>;
+}
+
+// One socket is shared by every component. Subscriptions are counted by their
+// channel, symbol and parameters so the server only hears about the first
+// subscriber and the last unsubscriber.
+let socket: WebSocket | null = null;
+const subscriptions = new Map<string, Subscription>();
+
+// A dropped socket is reopened while anything is still subscribed, waiting
+// twice as long after each failed attempt.
+const minReconnectDelay = 500;
+const maxReconnectDelay = 30_000;
+let reconnectDelay = minReconnectDelay;
+let reconnectTimer: ReturnType<typeof setTimeout> | null = null;
+
+function subscriptionKey(params: KrakenParams): string {
+    const sorted = Object.keys(params).sort().map(k => [k, params[k]]);
+    return JSON.stringify(sorted);
+}
+
+function send(method: "subscribe" | "unsubscribe", params: KrakenParams) {
+    if (socket?.readyState !== WebSocket.OPEN) return;
+    socket.send(JSON.stringify({
+        "type": "kraken",
+        "payload": {
+            "method": method,
+            "params": {...params, "symbol": [params.symbol]},
+        }
+    }));
+}
+
+function matches(params: KrakenParams, data: LiveChartData): boolean {
+    if (data.payload.channel !== params.channel) return false;
+    return data.payload.data.some(d =>
+        d.symbol === params.symbol && (params.interval === undefined || d.interval === params.interval));
+}
+
+function connect(): WebSocket {
+    if (socket) return socket;
+    const s = new WebSocket(ws_url);
+    s.onopen = () => {
+        reconnectDelay = minReconnectDelay;
+        subscriptions.forEach(sub => send("subscribe", sub.params));
+    };
+    s.onmessage = (e: MessageEvent) => {
+        const data = JSON.parse(e.data) as LiveChartData;
+        if (data.type !== "kraken" || !Array.isArray(data.payload.data)) return;
+        subscriptions.forEach(sub => {
+            if (!matches(sub.params, data)) return;
+            sub.handlers.forEach(h => h(data));
+        });
+    };
+    s.onclose = () => {
+        if (socket !== s) return;
+        socket = null;
+        scheduleReconnect();
+    };
+    socket = s;
+    return s;
+}
+
+function scheduleReconnect() {
+    if (reconnectTimer !== null || subscriptions.size === 0) return;
+    reconnectTimer = setTimeout(() => {
+        reconnectTimer = null;
+        if (subscriptions.size > 0) connect();
+    }, reconnectDelay);
+    reconnectDelay = Math.min(reconnectDelay * 2, maxReconnectDelay);
+}
+
+// subscribe registers handler for events matching params and returns a function
+// that removes it again.
+export function subscribe(params: KrakenParams, handler: Handler): () => void {
+    connect();
+    const key = subscriptionKey(params);
+    let sub = subscriptions.get(key);
+    if (!sub) {
+        sub = {params, handlers: new Set()};
+        subscriptions.set(key, sub);
+        send("subscribe", params);
+    }
+    sub.handlers.add(handler);
+    return () => {
+        const current = subscriptions.get(key);
+        if (!current) return;
+        current.handlers.delete(handler);
+        if (current.handlers.size > 0) return;
+        subscriptions.delete(key);
+        send("unsubscribe", params);
+        if (subscriptions.size === 0) {
+            if (reconnectTimer !== null) {
+                clearTimeout(reconnectTimer);
+                reconnectTimer = null;
+            }
+            reconnectDelay = minReconnectDelay;
+            socket?.close();
+            socket = null;
+        }
+    };
+}
@@ -1,33 +1,42 @@
 import {createFileRoute} from '@tanstack/react-router'
-import {useSuspenseQuery} from "@tanstack/react-query";
-import {getChart} from "@/actions/rest.ts";
+import {useSuspenseQueries} from "@tanstack/react-query";
+import {chartCandles, getChart} from "@/actions/rest.ts";
 import Chart, {ChartColors} from "@/components/Chart.tsx";
 
+// charts are shown together, all streaming over one websocket.
+const charts = [
+  {pair: "BTCUSD", symbol: "BTC/USD", interval: 1440},
+  {pair: "ETHUSD", symbol: "ETH/USD", interval: 60},
+];
+
+const chartColors = new ChartColors();
+
+function chartQuery(chart: typeof charts[number]) {
+  return {
+    queryKey: ['chart', chart.pair, chart.interval],
+    queryFn: () => getChart(chart.pair, chart.interval)
+  };
+}
+
 export const Route = createFileRoute('/')({
   component: App,
   pendingComponent: () => <div>Loading...</div>,
   errorComponent: () => <div>Error</div>,
   loader: async ({ context: { queryClient }}) => {
-    await Promise.all([
-      await queryClient.prefetchQuery({
-        queryKey: ['chart'],
-        queryFn: () => getChart("BTCUSD", 1440)
-      }),
-    ]);
+    await Promise.all(charts.map(c => queryClient.prefetchQuery(chartQuery(c))));
   }
 });
 
 function App() {
-  const chartQuery = useSuspenseQuery({
-    queryKey: ['chart'],
-    queryFn: () => getChart("BTCUSD", 1440)
-  })
+  const chartQueries = useSuspenseQueries({queries: charts.map(chartQuery)})
+  const height = Math.max(200, (window.innerHeight - 40) / charts.length);
   return (
     <>
       {
-        chartQuery.data ?
-            <Chart chartData={chartQuery.data.XXBTZUSD} chartColors={new ChartColors()} />
-        : null
+        charts.map((c, i) => chartQueries[i].data ?
+            <Chart key={`${c.symbol}:${c.interval}`} symbol={c.symbol} interval={c.interval}
+                   chartData={chartCandles(chartQueries[i].data)} chartColors={chartColors} height={height} />
+        : null)
       }
     </>
   )